@@ -21,6 +21,8 @@ DATASTORE_IP="localhost"
 
 MOUNTPATH="/dkv_mount_path/configs/"
 DEFAULT_CONFIGS=$(pwd)/mountpath/default
+# Bearer secret of the admin routes, new for every run.
+ADMIN_SECRET=$(head -c 16 /dev/urandom | od -An -tx1 | tr -d ' \n')
 TAG=1.0-SNAPSHOT-${UNIQUE_DOCKER_TAG}
 
 mkdir -p mountpath/default
@@ -40,7 +42,7 @@ popd
 
 docker login -u docker -p docker nexus3.onap.org:10001
 docker pull nexus3.onap.org:10001/onap/music/distributed-kv-store:${TAG}
-docker run -e DATASTORE=$DATASTORE -e DATASTORE_IP=$DATASTORE_IP -e MOUNTPATH=$MOUNTPATH -d \
+docker run -e DATASTORE=$DATASTORE -e DATASTORE_IP=$DATASTORE_IP -e MOUNTPATH=$MOUNTPATH -e ADMIN_SECRET=$ADMIN_SECRET -d \
            --name dkv \
            -v $DEFAULT_CONFIGS:/dkv_mount_path/configs/default \
            -p 8200:8200 -p 8080:8080 nexus3.onap.org:10001/onap/music/distributed-kv-store:${TAG}
@@ -50,6 +52,6 @@ sleep 10
 # add here all ROBOT_VARIABLES settings
 #
 echo "# music robot variables settings";
-ROBOT_VARIABLES="-v DKV_HOSTNAME:http://localhost -v DKV_PORT:8080"
+ROBOT_VARIABLES="-v DKV_HOSTNAME:http://localhost -v DKV_PORT:8080 -v DKV_ADMIN_SECRET:${ADMIN_SECRET}"
 
 echo ${ROBOT_VARIABLES}
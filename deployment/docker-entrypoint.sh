@@ -4,6 +4,16 @@ function start_consul_server {
     consul agent -bootstrap -server -bind=127.0.0.1 -data-dir=/dkv_mount_path/consul_data &
 }
 
+# ADMIN_SECRET may also be given as a file, such as a mounted Kubernetes or Docker secret.
+function read_admin_secret {
+    if [ -z "$ADMIN_SECRET" ] && [ -n "$ADMIN_SECRET_FILE" ]; then
+        export ADMIN_SECRET=$(cat "$ADMIN_SECRET_FILE")
+    fi
+    if [ -z "$ADMIN_SECRET" ]; then
+        echo "ADMIN_SECRET not set. Admin routes such as /v1/config/load-default will answer 401."
+    fi
+}
+
 function start_api_server {
     pushd /dkv_mount_path/
     ./dkv
@@ -15,4 +25,5 @@ if [ "$DATASTORE_IP" = "localhost" ]; then
         sleep 5
     fi
 fi
+read_admin_secret
 start_api_server
@@ -4,9 +4,11 @@ DATASTORE="consul"
 DATASTORE_IP="localhost"
 
 MOUNTPATH="/dkv_mount_path/configs/"
+ADMIN_SECRET=${ADMIN_SECRET:-$(head -c 16 /dev/urandom | od -An -tx1 | tr -d ' \n')}
+echo ADMIN_SECRET: $ADMIN_SECRET
 DEFAULT_CONFIGS=$(pwd)/../mountpath/default # TODO(sshank): Change this to think from Kubernetes Volumes perspective.
 
-docker run -e DATASTORE=$DATASTORE -e DATASTORE_IP=$DATASTORE_IP -e MOUNTPATH=$MOUNTPATH -it \
+docker run -e DATASTORE=$DATASTORE -e DATASTORE_IP=$DATASTORE_IP -e MOUNTPATH=$MOUNTPATH -e ADMIN_SECRET=$ADMIN_SECRET -it \
            --name dkv \
            -v $DEFAULT_CONFIGS:/dkv_mount_path/configs/default \
            -p 8200:8200 -p 8080:8080 nexus3.onap.org:10003/onap/music/distributed-kv-store
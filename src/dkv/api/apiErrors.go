@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Stable codes of the errors returned to clients, see ErrorDetail.
+const (
+	ERROR_INVALID             = "invalid"
+	ERROR_NOT_FOUND           = "not_found"
+	ERROR_CONFLICT            = "conflict"
+	ERROR_FORBIDDEN           = "forbidden"
+	ERROR_BACKEND_UNAVAILABLE = "backend_unavailable"
+	ERROR_INTERNAL            = "internal"
+	ERROR_UNAUTHORIZED        = "unauthorized"
+	ERROR_UNPROCESSABLE       = "unprocessable"
+)
+
+var errorStatuses = map[string]int{
+	ERROR_INVALID:             http.StatusBadRequest,
+	ERROR_NOT_FOUND:           http.StatusNotFound,
+	ERROR_CONFLICT:            http.StatusConflict,
+	ERROR_FORBIDDEN:           http.StatusForbidden,
+	ERROR_BACKEND_UNAVAILABLE: http.StatusServiceUnavailable,
+	ERROR_INTERNAL:            http.StatusInternalServerError,
+	ERROR_UNAUTHORIZED:        http.StatusUnauthorized,
+	ERROR_UNPROCESSABLE:       http.StatusUnprocessableEntity,
+}
+
+/*
+APIError is an error that can be shown to clients. Message never holds paths or
+the text of underlying errors, those are kept in Cause, which is only logged.
+*/
+type APIError struct {
+	Code    string
+	Message string
+	Cause   error
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func InvalidError(msg string) error {
+	return &APIError{Code: ERROR_INVALID, Message: msg}
+}
+
+func NotFoundError(msg string) error {
+	return &APIError{Code: ERROR_NOT_FOUND, Message: msg}
+}
+
+func ConflictError(msg string) error {
+	return &APIError{Code: ERROR_CONFLICT, Message: msg}
+}
+
+func ForbiddenError(msg string) error {
+	return &APIError{Code: ERROR_FORBIDDEN, Message: msg}
+}
+
+func BackendUnavailableError(cause error) error {
+	return &APIError{Code: ERROR_BACKEND_UNAVAILABLE, Message: "Datastore unavailable.", Cause: cause}
+}
+
+func InternalError(cause error) error {
+	return &APIError{Code: ERROR_INTERNAL, Message: "Internal error.", Cause: cause}
+}
+
+// DatastoreError reports errors of Datastore calls as the backend being unavailable.
+func DatastoreError(err error) error {
+	if _, ok := err.(*APIError); ok || err == nil {
+		return err
+	}
+	return BackendUnavailableError(err)
+}
+
+// FilesystemError maps the os errors of acting on what, named for clients.
+func FilesystemError(err error, what string) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return &APIError{Code: ERROR_NOT_FOUND, Message: what + " not found.", Cause: err}
+	case os.IsExist(err):
+		return &APIError{Code: ERROR_CONFLICT, Message: what + " already exists.", Cause: err}
+	}
+	if _, ok := err.(*APIError); ok {
+		return err
+	}
+	return InternalError(err)
+}
+
+// ErrorCode returns the code of err, ERROR_INTERNAL unless it is an APIError.
+func ErrorCode(err error) string {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.Code
+	}
+	return ERROR_INTERNAL
+}
+
+/*
+GenerateErrorResponse writes err with the status of its code. Errors other than
+APIError are internal, their text is logged and not returned.
+*/
+func GenerateErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr, ok := err.(*APIError)
+	if ok == false {
+		apiErr = InternalError(err).(*APIError)
+	}
+	if apiErr.Cause != nil {
+		log.Println("[ERROR]", r.Method, r.URL.Path, apiErr.Cause)
+	}
+	if IsV2(r) {
+		generateErrorV2(w, ErrorDetailV2{Code: apiErr.Code, Message: apiErr.Message})
+		return
+	}
+
+	req := ResponseErrorStruct{Response: apiErr.Message, Error: ErrorDetail{Code: apiErr.Code}}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(errorStatuses[apiErr.Code])
+	json.NewEncoder(w).Encode(req)
+}
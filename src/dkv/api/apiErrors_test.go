@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestGenerateErrorResponse(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		body   string
+	}{
+		{InvalidError("Invalid token."), 400, `{"response": "Invalid token.", "error": {"code": "invalid"}}`},
+		{NotFoundError("Gone."), 404, `{"response": "Gone.", "error": {"code": "not_found"}}`},
+		{ConflictError("Taken."), 409, `{"response": "Taken.", "error": {"code": "conflict"}}`},
+		{ForbiddenError("No."), 403, `{"response": "No.", "error": {"code": "forbidden"}}`},
+		{DatastoreError(errors.New("dial tcp 10.0.0.1:8500: refused")), 503,
+			`{"response": "Datastore unavailable.", "error": {"code": "backend_unavailable"}}`},
+		{errors.New("open /mnt/secret/token1: permission denied"), 500,
+			`{"response": "Internal error.", "error": {"code": "internal"}}`},
+	}
+
+	for _, c := range cases {
+		request, _ := http.NewRequest("GET", "/", nil)
+		response := httptest.NewRecorder()
+		GenerateErrorResponse(response, request, c.err)
+
+		assert.Equal(t, c.status, response.Code)
+		assert.JSONEq(t, c.body, response.Body.String())
+	}
+}
+
+func TestFilesystemError(t *testing.T) {
+	_, err := os.Stat("/nonexistent/dkv/file")
+	err = FilesystemError(err, "File a.properties")
+
+	assert.Equal(t, ERROR_NOT_FOUND, ErrorCode(err))
+	assert.Equal(t, "File a.properties not found.", err.Error())
+
+	err = FilesystemError(os.ErrExist, "Subdomain sub1")
+	assert.Equal(t, ERROR_CONFLICT, ErrorCode(err))
+
+	err = FilesystemError(InvalidError("Invalid filename."), "File")
+	assert.Equal(t, ERROR_INVALID, ErrorCode(err))
+
+	assert.Nil(t, FilesystemError(nil, "File"))
+}
+
+func TestHandleConfigDelete_not_found(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	oldDirectory := Directory
+	Directory = &DirectoryStruct{}
+	defer func() { Directory = oldDirectory }()
+
+	os.MkdirAll(MOUNTPATH+"token1", 0770)
+
+	request, _ := http.NewRequest("DELETE", "/v1/config/token1/missing.properties", nil)
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 404, response.Code, "404 response is expected")
+	assert.JSONEq(t, `{"response": "File missing.properties not found.", "error": {"code": "not_found"}}`,
+		response.Body.String())
+	assert.NotContains(t, response.Body.String(), MOUNTPATH, "The mount path should not be shown.")
+}
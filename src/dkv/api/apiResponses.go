@@ -0,0 +1,157 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+/*
+The /v2 routes share their handlers with /v1 and only differ in what is
+written back: structured objects instead of messages, 201 on create, 204 on
+delete, and every error in the same envelope, see ResponseErrorV2Struct.
+*/
+
+const versionKey contextKey = "version"
+
+// V2Responses marks the requests it passes on to get v2 responses.
+func V2Responses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey, 2)))
+	})
+}
+
+func IsV2(r *http.Request) bool {
+	version, _ := r.Context().Value(versionKey).(int)
+	return version == 2
+}
+
+type ServiceResult struct {
+	Token      string `json:"token"`
+	Service    string `json:"service"`
+	CreatedAt  string `json:"createdAt,omitempty"`
+	Subdomains int    `json:"subdomains"`
+	Secret     string `json:"secret,omitempty"`
+}
+
+type ServiceListResult struct {
+	Services []ServiceResult `json:"services"`
+}
+
+type CredentialResult struct {
+	Token  string `json:"token"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Secret string `json:"secret,omitempty"`
+}
+
+type CredentialListResult struct {
+	Credentials []CredentialInfo `json:"credentials"`
+}
+
+type SubdomainResult struct {
+	Token     string `json:"token"`
+	Subdomain string `json:"subdomain"`
+}
+
+type SubdomainListResult struct {
+	Subdomains []SubdomainInfo `json:"subdomains"`
+}
+
+type ConfigFileResult struct {
+	Token     string `json:"token"`
+	Subdomain string `json:"subdomain,omitempty"`
+	Filename  string `json:"filename"`
+}
+
+type ConfigLoadResult struct {
+	Token      string   `json:"token"`
+	Subdomain  string   `json:"subdomain,omitempty"`
+	Keys       int      `json:"keys"`
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+type KeyResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Layer string `json:"layer"`
+}
+
+type KeyListResult struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+type KeyValueListResult struct {
+	KeyValues []KeyValue `json:"keyValues"`
+	Cursor    string     `json:"cursor,omitempty"`
+}
+
+type EffectiveConfigResult struct {
+	Config map[string]EffectiveValue `json:"config"`
+}
+
+// ErrorDetailV2 holds the code and message of every v2 error and what else is known of it.
+type ErrorDetailV2 struct {
+	Code         string             `json:"code"`
+	Message      string             `json:"message"`
+	RequiredRole string             `json:"requiredRole,omitempty"`
+	Role         string             `json:"role,omitempty"`
+	Files        []*ConfigFileError `json:"files,omitempty"`
+	Unresolved   []string           `json:"unresolved,omitempty"`
+	Cycles       []string           `json:"cycles,omitempty"`
+	TooLarge     []string           `json:"tooLarge,omitempty"`
+}
+
+type ResponseErrorV2Struct struct {
+	Error ErrorDetailV2 `json:"error"`
+}
+
+/*
+GenerateResult writes v1 with 200 to /v1 requests, and result with status to
+/v2 requests. Results of 204 have no body.
+*/
+func GenerateResult(w http.ResponseWriter, r *http.Request, v1 interface{}, status int, result interface{}) {
+	if IsV2(r) == false {
+		status = http.StatusOK
+		result = v1
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func generateErrorV2(w http.ResponseWriter, detail ErrorDetailV2) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(errorStatuses[detail.Code])
+	json.NewEncoder(w).Encode(ResponseErrorV2Struct{Error: detail})
+}
+
+// serviceResult looks up what the registry knows of the service of token.
+func serviceResult(token string) (ServiceResult, bool, error) {
+	s, found, err := Directory.GetServiceInfo(token)
+	if err != nil || found == false {
+		return ServiceResult{}, false, err
+	}
+	return ServiceResult{Token: s.Token, Service: s.Service, CreatedAt: s.CreatedAt, Subdomains: s.Subdomains}, true, nil
+}
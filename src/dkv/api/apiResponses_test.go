@@ -0,0 +1,170 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// Mirrors the routes main.go registers under both /v1 and /v2.
+func RouterVersions() *mux.Router {
+	router := mux.NewRouter()
+	for _, version := range []string{"/v1", "/v2"} {
+		r := router.PathPrefix(version).Subrouter()
+		if version == "/v2" {
+			r.Use(V2Responses)
+		}
+		service := func(h http.HandlerFunc) http.HandlerFunc {
+			return RequireServiceAuth(TokenFromPath, h)
+		}
+		r.HandleFunc("/register", HandleServiceCreate).Methods("POST")
+		r.HandleFunc("/register", RequireAdminAuth(HandleServiceList)).Methods("GET")
+		r.HandleFunc("/register/{token}", service(HandleServiceGet)).Methods("GET")
+		r.HandleFunc("/register/{token}", service(HandleServiceDelete)).Methods("DELETE")
+		r.HandleFunc("/register/{token}/credentials", service(HandleServiceCredentialCreate)).Methods("POST")
+		r.HandleFunc("/register/{token}/subdomain", service(HandleServiceSubdomainCreate)).Methods("POST")
+		r.HandleFunc("/register/{token}/subdomain/{subdomain}", service(HandleServiceSubdomainDelete)).Methods("DELETE")
+		r.HandleFunc("/getconfig/{token}/{key}", service(HandleGET)).Methods("GET")
+		r.HandleFunc("/config/{token}/keys/{key}", service(HandleKeyPUT)).Methods("PUT")
+	}
+	return router
+}
+
+func setupVersions() func() {
+	cleanupMountpath := setupMountpath()
+	oldDirectory := Directory
+	oldAdminSecret := AdminSecret
+	oldKeyValues := KeyValues
+	Directory = &DirectoryStruct{}
+	AdminSecret = "admin1"
+	KeyValues = &KeyValuesStruct{}
+
+	return func() {
+		cleanupMountpath()
+		Directory = oldDirectory
+		AdminSecret = oldAdminSecret
+		KeyValues = oldKeyValues
+	}
+}
+
+func versionsRequest(method string, url string, body string, secret string) *httptest.ResponseRecorder {
+	var buffer *bytes.Buffer
+	if body != "" {
+		buffer = bytes.NewBufferString(body)
+	}
+	response := httptest.NewRecorder()
+	RouterVersions().ServeHTTP(response, authRequest(method, url, buffer, secret))
+	return response
+}
+
+func TestV2Responses(t *testing.T) {
+	cleanup := setupVersions()
+	defer cleanup()
+
+	response := versionsRequest("POST", "/v2/register", `{"domain": "service1"}`, "")
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var created ServiceResult
+	json.Unmarshal(response.Body.Bytes(), &created)
+	assert.NotEmpty(t, created.Token)
+	assert.NotEmpty(t, created.Secret)
+	assert.NotEmpty(t, created.CreatedAt)
+	assert.Equal(t, "service1", created.Service)
+	token := created.Token
+
+	response = versionsRequest("POST", "/v2/register", `{"domain": "service1"}`, "")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.JSONEq(t, `{"error": {"code": "conflict", "message": "Service already found. Check name."}}`, response.Body.String())
+
+	response = versionsRequest("GET", "/v2/register/"+token, "", created.Secret)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var found ServiceResult
+	json.Unmarshal(response.Body.Bytes(), &found)
+	assert.Equal(t, ServiceResult{Token: token, Service: "service1", CreatedAt: created.CreatedAt}, found)
+
+	response = versionsRequest("GET", "/v2/register", "", "admin1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"services":[{"token":"`+token+`"`)
+
+	response = versionsRequest("POST", "/v2/register/"+token+"/credentials", `{"name": "pods", "role": "read-only"}`, created.Secret)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	var credential CredentialResult
+	json.Unmarshal(response.Body.Bytes(), &credential)
+	assert.Equal(t, "pods", credential.Name)
+	assert.Equal(t, ROLE_READ_ONLY, credential.Role)
+	assert.NotEmpty(t, credential.Secret)
+
+	response = versionsRequest("POST", "/v2/register/"+token+"/subdomain", `{"subdomain": "sub1"}`, created.Secret)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.JSONEq(t, `{"token": "`+token+`", "subdomain": "sub1"}`, response.Body.String())
+
+	response = versionsRequest("PUT", "/v2/config/"+token+"/keys/key1", `{"value": "value1"}`, created.Secret)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"key": "key1", "value": "value1", "layer": "service"}`, response.Body.String())
+
+	response = versionsRequest("DELETE", "/v2/register/"+token+"/subdomain/sub1", "", created.Secret)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Empty(t, response.Body.String())
+
+	response = versionsRequest("GET", "/v2/getconfig/"+token+"/missing", "", created.Secret)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"error": {"code": "not_found", "message": "Key missing not found."}}`, response.Body.String())
+
+	response = versionsRequest("DELETE", "/v2/register/"+token, "", credential.Secret)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.JSONEq(t, `{"error": {"code": "forbidden", "message": "Credential pods has role read-only, admin required.",
+		"requiredRole": "admin", "role": "read-only"}}`, response.Body.String())
+
+	response = versionsRequest("GET", "/v2/register/"+token, "", "")
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.JSONEq(t, `{"error": {"code": "unauthorized", "message": "Authorization bearer secret not present."}}`, response.Body.String())
+
+	response = versionsRequest("DELETE", "/v2/register/"+token, "", created.Secret)
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	_, err := os.Stat(MOUNTPATH + token)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestV1Responses(t *testing.T) {
+	cleanup := setupVersions()
+	defer cleanup()
+
+	response := versionsRequest("POST", "/v1/register", `{"domain": "service1"}`, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var created ResponseStringStruct
+	json.Unmarshal(response.Body.Bytes(), &created)
+	assert.Regexp(t, `^Registration Successful. Token: \S+ Secret: \S+$`, created.Response)
+
+	services, _ := Directory.ListServices()
+	token := services[0].Token
+
+	response = versionsRequest("GET", "/v1/getconfig/"+token+"/missing", "", "admin1")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.JSONEq(t, `{"response": "Key missing not found.", "error": {"code": "not_found"}}`, response.Body.String())
+
+	response = versionsRequest("DELETE", "/v1/register/"+token, "", "admin1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"response": "Deletion of service is successful."}`, response.Body.String())
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/*
+AdminSecret is the bearer secret accepted on every route, including the global
+ones. It is read from ADMIN_SECRET by Initialise. When empty, admin routes
+reject every request.
+*/
+var AdminSecret = ""
+
+const (
+	ROLE_READ_ONLY = "read-only"
+	ROLE_WRITER    = "writer"
+	ROLE_ADMIN     = "admin"
+)
+
+// Each role may do everything the roles before it may.
+var roleLevels = map[string]int{
+	ROLE_READ_ONLY: 1,
+	ROLE_WRITER:    2,
+	ROLE_ADMIN:     3,
+}
+
+func ValidateRole(role string) error {
+	if _, found := roleLevels[role]; found == false {
+		return InvalidError("Unrecognised role. Supports only read-only, writer or admin.")
+	}
+	return nil
+}
+
+/*
+Principal is who a request was authenticated as. Token is the service the
+credential belongs to and is empty for the admin secret, which may act on every
+service and on the global routes.
+*/
+type Principal struct {
+	Token string
+	Name  string
+	Role  string
+}
+
+var AdminPrincipal = Principal{Token: "", Name: "admin", Role: ROLE_ADMIN}
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+func WithPrincipal(r *http.Request, p Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey, p))
+}
+
+func GetPrincipal(r *http.Request) (Principal, bool) {
+	p, found := r.Context().Value(principalKey).(Principal)
+	return p, found
+}
+
+type ErrorDetail struct {
+	Code         string `json:"code"`
+	RequiredRole string `json:"required_role,omitempty"`
+	Role         string `json:"role,omitempty"`
+}
+
+type ResponseErrorStruct struct {
+	Response string      `json:"response"`
+	Error    ErrorDetail `json:"error"`
+}
+
+/*
+Authorise reports whether the request may act on the service identified by
+token with the given role, writing a 401 or 403 response if not. An empty token
+stands for the global routes, which only the admin secret may use.
+*/
+func Authorise(w http.ResponseWriter, r *http.Request, token string, role string) bool {
+	p, found := GetPrincipal(r)
+	if found == false {
+		generateUnauthorized(w, r, "Request not authenticated.")
+		return false
+	}
+	if p == AdminPrincipal {
+		return true
+	}
+
+	var msg = ""
+	if token == "" {
+		msg = "Admin secret required."
+	} else if p.Token != token {
+		msg = "Credential " + p.Name + " is not valid for Token: " + token
+	} else if roleLevels[p.Role] < roleLevels[role] {
+		msg = "Credential " + p.Name + " has role " + p.Role + ", " + role + " required."
+	} else {
+		return true
+	}
+
+	if IsV2(r) {
+		generateErrorV2(w, ErrorDetailV2{Code: ERROR_FORBIDDEN, Message: msg, RequiredRole: role, Role: p.Role})
+		return false
+	}
+	req := ResponseErrorStruct{
+		Response: msg,
+		Error:    ErrorDetail{Code: "forbidden", RequiredRole: role, Role: p.Role},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(req)
+	return false
+}
+
+/*
+TokenExtractor finds the service token a request is acting on. It runs before
+the request is authenticated, so an error is answered as it is.
+*/
+type TokenExtractor func(*http.Request) (string, error)
+
+func TokenFromPath(r *http.Request) (string, error) {
+	return mux.Vars(r)["token"], nil
+}
+
+func TokenFromForm(r *http.Request) (string, error) {
+	// Same limit as HandleConfigUpload. The parsed form is kept on the request.
+	r.ParseMultipartForm(100000)
+	return r.Form.Get("token"), nil
+}
+
+// Bodies read before authentication are cut off past this size.
+const MAX_BODY_SIZE = 1024 * 1024
+
+/*
+TokenFromBody reads the token field of a JSON body and puts the body back for
+the handler. Bodies past MAX_BODY_SIZE are refused without being read further.
+*/
+func TokenFromBody(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return "", nil
+	}
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, MAX_BODY_SIZE))
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	if _, tooLarge := err.(*http.MaxBytesError); tooLarge {
+		return "", InvalidError("Body too large.")
+	}
+	if err != nil {
+		return "", nil
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(raw, &body)
+	return body.Token, nil
+}
+
+// GenerateSecret returns a random secret handed out once, when a credential is created.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Only the hash of a credential secret is kept in the registry.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func bearerSecret(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+func isAdminSecret(secret string) bool {
+	if AdminSecret == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(AdminSecret)) == 1
+}
+
+func generateUnauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	if IsV2(r) {
+		generateErrorV2(w, ErrorDetailV2{Code: ERROR_UNAUTHORIZED, Message: msg})
+		return
+	}
+	GenerateResponse(w, r, http.StatusUnauthorized, msg)
+}
+
+/*
+RequireServiceAuth only lets a request through if it carries a secret of one of
+the credentials of the service whose token it acts on, or the admin secret. The
+matching credential is attached to the request for the handler to check its
+role. Unknown tokens and wrong secrets get the same answer so that tokens
+cannot be probed.
+*/
+func RequireServiceAuth(extract TokenExtractor, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerSecret(r)
+		if secret == "" {
+			generateUnauthorized(w, r, "Authorization bearer secret not present.")
+			return
+		}
+		if isAdminSecret(secret) {
+			next(w, WithPrincipal(r, AdminPrincipal))
+			return
+		}
+
+		token, err := extract(r)
+		if err != nil {
+			GenerateErrorResponse(w, r, err)
+			return
+		}
+		if token == "" {
+			generateUnauthorized(w, r, "Token not present in request.")
+			return
+		}
+
+		credentials, _, err := Registry.GetCredentials(token)
+		if err != nil {
+			GenerateErrorResponse(w, r, DatastoreError(err))
+			return
+		}
+
+		secretHash := []byte(HashSecret(secret))
+		for _, credential := range credentials {
+			if subtle.ConstantTimeCompare(secretHash, []byte(credential.SecretHash)) == 1 {
+				next(w, WithPrincipal(r, Principal{Token: token, Name: credential.Name, Role: credential.Role}))
+				return
+			}
+		}
+		generateUnauthorized(w, r, "Invalid secret for Token: "+token)
+	}
+}
+
+// RequireAdminAuth guards the routes that act on all services at once.
+func RequireAdminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerSecret(r)
+		if secret == "" {
+			generateUnauthorized(w, r, "Authorization bearer secret not present.")
+			return
+		}
+		if isAdminSecret(secret) == false {
+			generateUnauthorized(w, r, "Admin secret required.")
+			return
+		}
+		next(w, WithPrincipal(r, AdminPrincipal))
+	}
+}
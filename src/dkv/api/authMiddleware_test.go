@@ -0,0 +1,340 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func handleOK(w http.ResponseWriter, r *http.Request) {
+	GenerateResponse(w, r, http.StatusOK, "ok")
+}
+
+func RouterAuth() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/register/{token}", RequireServiceAuth(TokenFromPath, handleOK)).Methods("GET")
+	router.HandleFunc("/v1/config", RequireServiceAuth(TokenFromForm, handleOK)).Methods("POST")
+	router.HandleFunc("/v1/config/load", RequireServiceAuth(TokenFromBody, HandleConfigLoad)).Methods("POST")
+	router.HandleFunc("/v1/getconfigs", RequireAdminAuth(handleOK)).Methods("GET")
+	return router
+}
+
+// Test routers skip authentication and act as the given principal.
+func asPrincipal(p Principal) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, WithPrincipal(r, p))
+		})
+	}
+}
+
+/*
+Registers service1 as token1 in a memory registry with the credentials owner
+(secret1, admin), ci (ci1, writer) and pods (pods1, read-only), and sets the
+admin secret.
+*/
+func setupAuth() func() {
+	oldRegistry := Registry
+	oldAdminSecret := AdminSecret
+
+	cleanupDatastore := setupMemoryDatastore()
+	Registry = &DatastoreRegistryStruct{}
+	Registry.AddService("token1", "service1")
+	Registry.SetCredential("token1", Credential{Name: OWNER_CREDENTIAL, Role: ROLE_ADMIN, SecretHash: HashSecret("secret1")})
+	Registry.SetCredential("token1", Credential{Name: "ci", Role: ROLE_WRITER, SecretHash: HashSecret("ci1")})
+	Registry.SetCredential("token1", Credential{Name: "pods", Role: ROLE_READ_ONLY, SecretHash: HashSecret("pods1")})
+	// Registered before credentials existed.
+	Registry.AddService("token2", "service2")
+	AdminSecret = "admin1"
+
+	return func() {
+		cleanupDatastore()
+		Registry = oldRegistry
+		AdminSecret = oldAdminSecret
+	}
+}
+
+func authRequest(method string, url string, body *bytes.Buffer, secret string) *http.Request {
+	var request *http.Request
+	if body == nil {
+		request, _ = http.NewRequest(method, url, nil)
+	} else {
+		request, _ = http.NewRequest(method, url, body)
+	}
+	if secret != "" {
+		request.Header.Set("Authorization", "Bearer "+secret)
+	}
+	return request
+}
+
+func TestRequireServiceAuth(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	cases := []struct {
+		url    string
+		secret string
+		code   int
+	}{
+		{"/v1/register/token1", "secret1", 200},
+		{"/v1/register/token1", "pods1", 200},
+		{"/v1/register/token1", "admin1", 200},
+		{"/v1/register/token1", "", 401},
+		{"/v1/register/token1", "secret2", 401},
+		// The public token is not a secret.
+		{"/v1/register/token1", "token1", 401},
+		{"/v1/register/token2", "secret1", 401},
+		{"/v1/register/token2", "admin1", 200},
+		{"/v1/register/token3", "secret1", 401},
+	}
+
+	for _, c := range cases {
+		response := httptest.NewRecorder()
+		RouterAuth().ServeHTTP(response, authRequest("GET", c.url, nil, c.secret))
+		assert.Equal(t, c.code, response.Code, c.url+" with secret "+c.secret)
+	}
+}
+
+func TestRequireServiceAuth_header(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	request, _ := http.NewRequest("GET", "/v1/register/token1", nil)
+	request.Header.Set("Authorization", "Basic secret1")
+	response := httptest.NewRecorder()
+	RouterAuth().ServeHTTP(response, request)
+
+	assert.Equal(t, 401, response.Code, "401 response is expected")
+	assert.Equal(t, "Bearer", response.Header().Get("WWW-Authenticate"))
+}
+
+func TestRequireServiceAuth_form(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	for secret, code := range map[string]int{"secret1": 200, "secret2": 401} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("token", "token1")
+		writer.Close()
+
+		request := authRequest("POST", "/v1/config", body, secret)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		response := httptest.NewRecorder()
+		RouterAuth().ServeHTTP(response, request)
+
+		assert.Equal(t, code, response.Code)
+	}
+}
+
+func TestRequireServiceAuth_body(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	oldKeyValues := KeyValues
+	KeyValues = &FakeKeyValues{}
+	defer func() { KeyValues = oldKeyValues }()
+
+	body := bytes.NewBufferString(`{"token":"token1","filename":"test.properties"}`)
+	response := httptest.NewRecorder()
+	RouterAuth().ServeHTTP(response, authRequest("POST", "/v1/config/load", body, "secret1"))
+	// The handler still gets to decode the body.
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+
+	body = bytes.NewBufferString(`{"token":"token2","filename":"test.properties"}`)
+	response = httptest.NewRecorder()
+	RouterAuth().ServeHTTP(response, authRequest("POST", "/v1/config/load", body, "secret1"))
+	assert.Equal(t, 401, response.Code, "401 response is expected")
+}
+
+func TestRequireServiceAuth_err(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	oldDatastore := Datastore
+	Datastore = &FakeConsulErr{}
+	defer func() { Datastore = oldDatastore }()
+
+	response := httptest.NewRecorder()
+	RouterAuth().ServeHTTP(response, authRequest("GET", "/v1/register/token1", nil, "secret1"))
+	assert.Equal(t, 503, response.Code, "503 response is expected")
+}
+
+func TestRequireAdminAuth(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	for secret, code := range map[string]int{"admin1": 200, "secret1": 401, "": 401} {
+		response := httptest.NewRecorder()
+		RouterAuth().ServeHTTP(response, authRequest("GET", "/v1/getconfigs", nil, secret))
+		assert.Equal(t, code, response.Code, "secret "+secret)
+	}
+
+	// Without an admin secret configured nothing gets through.
+	AdminSecret = ""
+	response := httptest.NewRecorder()
+	RouterAuth().ServeHTTP(response, authRequest("GET", "/v1/getconfigs", nil, ""))
+	assert.Equal(t, 401, response.Code, "401 response is expected")
+}
+
+func TestTokenFromBody(t *testing.T) {
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBufferString(`{"token":"token1"}`))
+
+	token, err := TokenFromBody(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "token1", token)
+	raw, _ := ioutil.ReadAll(request.Body)
+	assert.Equal(t, `{"token":"token1"}`, string(raw), "Body should be readable again.")
+}
+
+func TestTokenFromBody_tooLarge(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	body := `{"token":"token1","variables":{"a":"` + strings.Repeat("a", MAX_BODY_SIZE) + `"}}`
+	response := httptest.NewRecorder()
+	RouterAuth().ServeHTTP(response, authRequest("POST", "/v1/config/load", bytes.NewBufferString(body), "secret1"))
+
+	assert.Equal(t, 400, response.Code, "400 response is expected")
+	assert.JSONEq(t, `{"response": "Body too large.", "error": {"code": "invalid"}}`, response.Body.String())
+}
+
+func TestHashSecret(t *testing.T) {
+	secret1, err := GenerateSecret()
+	assert.Nil(t, err)
+	secret2, _ := GenerateSecret()
+	assert.NotEqual(t, secret1, secret2)
+	assert.Len(t, secret1, 64)
+
+	assert.Equal(t, HashSecret(secret1), HashSecret(secret1))
+	assert.NotEqual(t, secret1, HashSecret(secret1))
+}
+
+func TestRequireServiceAuth_principal(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	var got Principal
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/register/{token}", RequireServiceAuth(TokenFromPath,
+		func(w http.ResponseWriter, r *http.Request) { got, _ = GetPrincipal(r) }))
+
+	router.ServeHTTP(httptest.NewRecorder(), authRequest("GET", "/v1/register/token1", nil, "ci1"))
+	assert.Equal(t, Principal{Token: "token1", Name: "ci", Role: ROLE_WRITER}, got)
+
+	router.ServeHTTP(httptest.NewRecorder(), authRequest("GET", "/v1/register/token1", nil, "admin1"))
+	assert.Equal(t, AdminPrincipal, got)
+}
+
+func TestAuthorise(t *testing.T) {
+	owner := Principal{Token: "token1", Name: "owner", Role: ROLE_ADMIN}
+	ci := Principal{Token: "token1", Name: "ci", Role: ROLE_WRITER}
+	pods := Principal{Token: "token1", Name: "pods", Role: ROLE_READ_ONLY}
+
+	cases := []struct {
+		p       Principal
+		token   string
+		role    string
+		allowed bool
+	}{
+		{pods, "token1", ROLE_READ_ONLY, true},
+		{pods, "token1", ROLE_WRITER, false},
+		{ci, "token1", ROLE_WRITER, true},
+		{ci, "token1", ROLE_ADMIN, false},
+		{owner, "token1", ROLE_ADMIN, true},
+		// Credentials only count for their own service.
+		{owner, "token2", ROLE_READ_ONLY, false},
+		// Global routes need the admin secret.
+		{owner, "", ROLE_ADMIN, false},
+		{AdminPrincipal, "", ROLE_ADMIN, true},
+		{AdminPrincipal, "token2", ROLE_ADMIN, true},
+	}
+
+	for _, c := range cases {
+		request, _ := http.NewRequest("GET", "/", nil)
+		response := httptest.NewRecorder()
+		allowed := Authorise(response, WithPrincipal(request, c.p), c.token, c.role)
+		assert.Equal(t, c.allowed, allowed, c.p.Name+" on "+c.token+" as "+c.role)
+		if c.allowed == false {
+			assert.Equal(t, 403, response.Code, "403 response is expected")
+		}
+	}
+}
+
+func TestAuthorise_unauthenticated(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+
+	assert.False(t, Authorise(response, request, "token1", ROLE_READ_ONLY))
+	assert.Equal(t, 401, response.Code, "401 response is expected")
+}
+
+func TestAuthorise_handlers(t *testing.T) {
+	cleanup := setupAuth()
+	defer cleanup()
+
+	oldDatastore := Datastore
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() {
+		Datastore = oldDatastore
+		Directory = oldDirectory
+	}()
+	Datastore.RequestPUT("token1/", "key1", "value1")
+
+	router := mux.NewRouter()
+	service := func(h http.HandlerFunc) http.HandlerFunc { return RequireServiceAuth(TokenFromPath, h) }
+	router.HandleFunc("/v1/getconfig/{token}/{key}", service(HandleGET)).Methods("GET")
+	router.HandleFunc("/v1/config/{token}/{filename}", service(HandleConfigDelete)).Methods("DELETE")
+	router.HandleFunc("/v1/register/{token}", service(HandleServiceDelete)).Methods("DELETE")
+
+	cases := []struct {
+		method string
+		url    string
+		secret string
+		code   int
+	}{
+		{"GET", "/v1/getconfig/token1/key1", "pods1", 200},
+		{"DELETE", "/v1/config/token1/test.properties", "pods1", 403},
+		{"DELETE", "/v1/config/token1/test.properties", "ci1", 200},
+		{"DELETE", "/v1/register/token1", "ci1", 403},
+		{"DELETE", "/v1/register/token1", "secret1", 200},
+	}
+
+	for _, c := range cases {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, authRequest(c.method, c.url, nil, c.secret))
+		assert.Equal(t, c.code, response.Code, c.method+" "+c.url+" with secret "+c.secret)
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, authRequest("DELETE", "/v1/config/token1/test.properties", nil, "pods1"))
+
+	var body ResponseErrorStruct
+	json.NewDecoder(response.Body).Decode(&body)
+	assert.Equal(t, ErrorDetail{Code: "forbidden", RequiredRole: ROLE_WRITER, Role: ROLE_READ_ONLY}, body.Error)
+	assert.NotEmpty(t, body.Response)
+}
@@ -17,37 +17,297 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
-	"os"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
-// (TODO)sahank: Complete MUSIC Cassandra Connections.
+// CassandraStruct keeps key values in a single table through the MUSIC REST API.
+type CassandraStruct struct {
+	musicURL   string
+	keyspace   string
+	table      string
+	ns         string
+	userID     string
+	password   string
+	httpClient *http.Client
+}
+
+const (
+	MUSIC_DEFAULT_PORT     = "8080"
+	MUSIC_DEFAULT_KEYSPACE = "dkv"
+	MUSIC_DEFAULT_TABLE    = "keyvalues"
+	MUSIC_BASE_PATH        = "/MUSIC/rest/v2"
+)
+
+type musicConsistencyInfo struct {
+	Type string `json:"type"`
+}
+
+type musicKeyspaceBody struct {
+	ReplicationInfo    map[string]interface{} `json:"replicationInfo"`
+	DurabilityOfWrites string                 `json:"durabilityOfWrites"`
+	ConsistencyInfo    musicConsistencyInfo   `json:"consistencyInfo"`
+}
+
+type musicTableBody struct {
+	KeyspaceName    string               `json:"keyspaceName"`
+	TableName       string               `json:"tableName"`
+	Fields          map[string]string    `json:"fields"`
+	ConsistencyInfo musicConsistencyInfo `json:"consistencyInfo"`
+}
+
+type musicRowBody struct {
+	KeyspaceName    string               `json:"keyspaceName,omitempty"`
+	TableName       string               `json:"tableName,omitempty"`
+	Values          map[string]string    `json:"values,omitempty"`
+	ConsistencyInfo musicConsistencyInfo `json:"consistencyInfo"`
+}
+
+type musicResponse struct {
+	Status string                       `json:"status"`
+	Error  string                       `json:"error"`
+	Result map[string]map[string]string `json:"result"`
+}
+
+func init() {
+	RegisterDatastore("cassandra", NewCassandraStruct, []DatastoreConfigOption{
+		{Name: "DATASTORE_IP", Required: true},
+		{Name: "DATASTORE_PORT", Default: MUSIC_DEFAULT_PORT},
+		{Name: "MUSIC_KEYSPACE", Default: MUSIC_DEFAULT_KEYSPACE},
+		{Name: "MUSIC_TABLE", Default: MUSIC_DEFAULT_TABLE},
+		{Name: "MUSIC_NS"},
+		{Name: "MUSIC_USERID"},
+		{Name: "MUSIC_PASSWORD"},
+	})
+}
 
-type CassandraStruct struct{}
+func NewCassandraStruct(config DatastoreConfig) DatastoreConnector {
+	return &CassandraStruct{
+		musicURL: "http://" + config["DATASTORE_IP"] + ":" + config["DATASTORE_PORT"] + MUSIC_BASE_PATH,
+		keyspace: config["MUSIC_KEYSPACE"],
+		table:    config["MUSIC_TABLE"],
+		ns:       config["MUSIC_NS"],
+		userID:   config["MUSIC_USERID"],
+		password: config["MUSIC_PASSWORD"],
+	}
+}
 
 func (c *CassandraStruct) InitializeDatastoreClient() error {
-	if os.Getenv("DATASTORE_IP") == "" {
-		return errors.New("DATASTORE_IP environment variable not set.")
+	if c.musicURL == "" {
+		return errors.New("MUSIC URL not set.")
 	}
+
+	c.httpClient = &http.Client{Timeout: 10 * time.Second}
+
 	return nil
 }
 
+// CheckDatastoreHealth also provisions the keyspace and table, every replica runs it.
 func (c *CassandraStruct) CheckDatastoreHealth() error {
+	_, err := c.musicRequest("GET", "/version", nil, nil)
+	if err != nil {
+		return errors.New("[ERROR] Cannot talk to Datastore. Check if it is running/reachable.")
+	}
+
+	err = c.createKeyspace()
+	if err != nil {
+		return err
+	}
+
+	err = c.createTable()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 func (c *CassandraStruct) RequestPUT(prefix string, key string, value string) error {
+	key = prefix + key
+
+	body := musicRowBody{
+		KeyspaceName:    c.keyspace,
+		TableName:       c.table,
+		Values:          map[string]string{"key": key, "value": value},
+		ConsistencyInfo: musicConsistencyInfo{Type: "eventual"},
+	}
+
+	_, err := c.musicRequest("POST", c.rowsPath(), nil, body)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
-func (c *CassandraStruct) RequestGET(prefix string, key string) (string, error) {
-	return "", nil
+func (c *CassandraStruct) RequestGET(prefix string, key string) (string, bool, error) {
+	key = prefix + key
+
+	query := url.Values{}
+	query.Set("key", key)
+
+	resp, err := c.musicRequest("GET", c.rowsPath(), query, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, row := range resp.Result {
+		if row["key"] == key {
+			return row["value"], true, nil
+		}
+	}
+	return "", false, nil
 }
 
-func (c *CassandraStruct) RequestGETS() ([]string, error) {
-	return []string{"", ""}, nil
+/*
+RequestLIST reads the whole table and filters the rows itself. The MUSIC REST
+API only selects rows by equal column values and has neither a row limit nor the
+paging state of a query to hand out, so a Limit or After is refused instead of
+paging over a full read of the table.
+*/
+func (c *CassandraStruct) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
+	if options.Limit > 0 || options.After != "" {
+		return nil, false, InvalidError("Listings of the cassandra datastore cannot be paged.")
+	}
+
+	resp, err := c.musicRequest("GET", c.rowsPath(), nil, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	res := []KeyValue{}
+
+	for _, row := range resp.Result {
+		if key, found := options.listedKey(prefix, row["key"]); found {
+			res = append(res, KeyValue{Key: key, Value: row["value"]})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+
+	return res, false, nil
 }
 
 func (c *CassandraStruct) RequestDELETE(prefix string, key string) error {
+	key = prefix + key
+
+	query := url.Values{}
+	query.Set("key", key)
+
+	body := musicRowBody{
+		ConsistencyInfo: musicConsistencyInfo{Type: "eventual"},
+	}
+
+	_, err := c.musicRequest("DELETE", c.rowsPath(), query, body)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *CassandraStruct) createKeyspace() error {
+	body := musicKeyspaceBody{
+		ReplicationInfo: map[string]interface{}{
+			"class":              "SimpleStrategy",
+			"replication_factor": 1,
+		},
+		DurabilityOfWrites: "true",
+		ConsistencyInfo:    musicConsistencyInfo{Type: "eventual"},
+	}
+
+	_, err := c.musicRequest("POST", "/keyspaces/"+c.keyspace, nil, body)
+	if err != nil && !strings.Contains(err.Error(), "already exists") {
+		return err
+	}
+	return nil
+}
+
+func (c *CassandraStruct) createTable() error {
+	body := musicTableBody{
+		KeyspaceName: c.keyspace,
+		TableName:    c.table,
+		Fields: map[string]string{
+			"key":         "text",
+			"value":       "text",
+			"PRIMARY KEY": "(key)",
+		},
+		ConsistencyInfo: musicConsistencyInfo{Type: "eventual"},
+	}
+
+	_, err := c.musicRequest("POST", "/keyspaces/"+c.keyspace+"/tables/"+c.table, nil, body)
+	if err != nil && !strings.Contains(err.Error(), "already exists") {
+		return err
+	}
 	return nil
 }
+
+func (c *CassandraStruct) rowsPath() string {
+	return "/keyspaces/" + c.keyspace + "/tables/" + c.table + "/rows"
+}
+
+// musicRequest returns non 2xx and FAILURE responses as errors with the message MUSIC sent.
+func (c *CassandraStruct) musicRequest(
+	method string, path string, query url.Values, body interface{}) (musicResponse, error) {
+
+	var result musicResponse
+	var reader io.Reader
+
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return result, err
+		}
+		reader = bytes.NewBuffer(raw)
+	}
+
+	target := c.musicURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.ns != "" {
+		req.Header.Set("ns", c.ns)
+	}
+	if c.userID != "" {
+		req.Header.Set("userId", c.userID)
+		req.Header.Set("password", c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return result, err
+	}
+
+	if len(raw) > 0 {
+		err = json.Unmarshal(raw, &result)
+		if err != nil {
+			return result, errors.New("Unexpected response from MUSIC: " + string(raw))
+		}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || result.Status == "FAILURE" {
+		if result.Error != "" {
+			return result, errors.New(result.Error)
+		}
+		return result, errors.New("MUSIC request failed with status: " + resp.Status)
+	}
+
+	return result, nil
+}
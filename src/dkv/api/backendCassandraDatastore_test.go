@@ -0,0 +1,184 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// Starts a FakeMUSIC server and points the DATASTORE_* variables at it.
+func startFakeMUSIC() (*httptest.Server, func()) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	oldDatastore_port := os.Getenv("DATASTORE_PORT")
+
+	server := httptest.NewServer(NewFakeMUSIC())
+	u, _ := url.Parse(server.URL)
+
+	os.Setenv("DATASTORE_IP", u.Hostname())
+	os.Setenv("DATASTORE_PORT", u.Port())
+
+	return server, func() {
+		server.Close()
+		os.Setenv("DATASTORE_IP", oldDatastore_ip)
+		os.Setenv("DATASTORE_PORT", oldDatastore_port)
+	}
+}
+
+func TestCassandraNewDatastore_noIP(t *testing.T) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	defer os.Setenv("DATASTORE_IP", oldDatastore_ip)
+	os.Setenv("DATASTORE_IP", "")
+
+	_, err := NewDatastore("cassandra")
+	assert.NotNil(t, err)
+}
+
+func TestCassandraCheckDatastoreHealth(t *testing.T) {
+	_, cleanup := startFakeMUSIC()
+	defer cleanup()
+
+	c := newTestDatastore("cassandra").(*CassandraStruct)
+	err := c.InitializeDatastoreClient()
+	assert.Nil(t, err)
+
+	err = c.CheckDatastoreHealth()
+	assert.Nil(t, err, "Keyspace and table should be provisioned.")
+
+	// A second replica starting up must not fail on the existing schema.
+	err = c.CheckDatastoreHealth()
+	assert.Nil(t, err, "Provisioning should be idempotent.")
+}
+
+func TestCassandraCheckDatastoreHealth_unreachable(t *testing.T) {
+	server, cleanup := startFakeMUSIC()
+	defer cleanup()
+
+	c := newTestDatastore("cassandra").(*CassandraStruct)
+	c.InitializeDatastoreClient()
+	server.Close()
+
+	err := c.CheckDatastoreHealth()
+	assert.NotNil(t, err)
+}
+
+func TestCassandraRequests(t *testing.T) {
+	_, cleanup := startFakeMUSIC()
+	defer cleanup()
+
+	c := newTestDatastore("cassandra").(*CassandraStruct)
+	c.InitializeDatastoreClient()
+	c.CheckDatastoreHealth()
+
+	assert.Equal(t, []string{}, listAllKeys(t, c))
+
+	err := c.RequestPUT("token1/", "key1", "value1")
+	assert.Nil(t, err)
+	err = c.RequestPUT("token1/subdomain1/", "key2", "value2")
+	assert.Nil(t, err)
+
+	value, _, err := c.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", value)
+
+	value, _, err = c.RequestGET("token1/subdomain1/", "key2")
+	assert.Nil(t, err)
+	assert.Equal(t, "value2", value)
+
+	err = c.RequestPUT("token1/", "key1", "value3")
+	assert.Nil(t, err)
+	value, _, _ = c.RequestGET("token1/", "key1")
+	assert.Equal(t, "value3", value, "PUT should overwrite an existing key.")
+
+	assert.Equal(t, []string{"token1/key1", "token1/subdomain1/key2"}, listAllKeys(t, c))
+
+	err = c.RequestDELETE("token1/", "key1")
+	assert.Nil(t, err)
+
+	_, found, err := c.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestCassandraConformance(t *testing.T) {
+	_, cleanup := startFakeMUSIC()
+	defer cleanup()
+
+	c := newTestDatastore("cassandra")
+	c.InitializeDatastoreClient()
+	err := c.CheckDatastoreHealth()
+	assert.Nil(t, err)
+
+	runDatastoreConformance(t, c)
+}
+
+func TestCassandraRequests_noTable(t *testing.T) {
+	_, cleanup := startFakeMUSIC()
+	defer cleanup()
+
+	// Without CheckDatastoreHealth the table is never provisioned.
+	c := newTestDatastore("cassandra").(*CassandraStruct)
+	c.InitializeDatastoreClient()
+
+	err := c.RequestPUT("token1/", "key1", "value1")
+	assert.NotNil(t, err)
+
+	_, _, err = c.RequestGET("token1/", "key1")
+	assert.NotNil(t, err)
+}
+
+func TestCassandraRequestLIST_paging(t *testing.T) {
+	_, cleanup := startFakeMUSIC()
+	defer cleanup()
+
+	c := newTestDatastore("cassandra")
+	c.InitializeDatastoreClient()
+	c.CheckDatastoreHealth()
+	c.RequestPUT("token1/", "key1", "value1")
+
+	_, _, err := c.RequestLIST("token1/", ListOptions{Limit: 1})
+	assert.Equal(t, ERROR_INVALID, ErrorCode(err), "MUSIC cannot page.")
+
+	_, _, err = c.RequestLIST("token1/", ListOptions{After: "key0"})
+	assert.Equal(t, ERROR_INVALID, ErrorCode(err))
+
+	kvs, more, err := c.RequestLIST("token1/", ListOptions{})
+	assert.Nil(t, err)
+	assert.False(t, more)
+	assert.Equal(t, []KeyValue{{Key: "key1", Value: "value1"}}, kvs)
+}
+
+func TestCassandraNewDatastore_table(t *testing.T) {
+	_, cleanup := startFakeMUSIC()
+	defer cleanup()
+	oldTable := os.Getenv("MUSIC_TABLE")
+	defer os.Setenv("MUSIC_TABLE", oldTable)
+
+	os.Setenv("MUSIC_TABLE", "")
+	c := newTestDatastore("cassandra").(*CassandraStruct)
+	assert.Equal(t, MUSIC_DEFAULT_TABLE, c.table)
+
+	os.Setenv("MUSIC_TABLE", "dkv_keys")
+	c = newTestDatastore("cassandra").(*CassandraStruct)
+	c.InitializeDatastoreClient()
+	assert.Equal(t, "dkv_keys", c.table)
+	assert.Nil(t, c.CheckDatastoreHealth())
+	assert.Nil(t, c.RequestPUT("token1/", "key1", "value1"))
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+FakeMUSIC is a local stand-in for the subset of the MUSIC REST API used by
+CassandraStruct. It keeps keyspaces, tables and rows in memory so that the
+Cassandra backend can be exercised without a MUSIC/Cassandra cluster. Serve it
+with httptest.NewServer and point DATASTORE_IP/DATASTORE_PORT at it.
+*/
+type FakeMUSIC struct {
+	mutex     sync.Mutex
+	keyspaces map[string]bool
+	tables    map[string]map[string]string
+}
+
+func NewFakeMUSIC() *FakeMUSIC {
+	return &FakeMUSIC{
+		keyspaces: make(map[string]bool),
+		tables:    make(map[string]map[string]string),
+	}
+}
+
+func (f *FakeMUSIC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, MUSIC_BASE_PATH)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "version" && r.Method == "GET":
+		f.respond(w, http.StatusOK, map[string]interface{}{"status": "SUCCESS", "version": "fake"})
+
+	case len(parts) == 2 && parts[0] == "keyspaces" && r.Method == "POST":
+		if f.keyspaces[parts[1]] {
+			f.fail(w, "Keyspace "+parts[1]+" already exists")
+			return
+		}
+		f.keyspaces[parts[1]] = true
+		f.respond(w, http.StatusOK, map[string]interface{}{"status": "SUCCESS"})
+
+	case len(parts) == 4 && parts[0] == "keyspaces" && parts[2] == "tables" && r.Method == "POST":
+		if !f.keyspaces[parts[1]] {
+			f.fail(w, "Keyspace "+parts[1]+" does not exist")
+			return
+		}
+		name := parts[1] + "." + parts[3]
+		if _, ok := f.tables[name]; ok {
+			f.fail(w, "Table "+name+" already exists")
+			return
+		}
+		f.tables[name] = make(map[string]string)
+		f.respond(w, http.StatusOK, map[string]interface{}{"status": "SUCCESS"})
+
+	case len(parts) == 5 && parts[0] == "keyspaces" && parts[2] == "tables" && parts[4] == "rows":
+		rows, ok := f.tables[parts[1]+"."+parts[3]]
+		if !ok {
+			f.fail(w, "Table "+parts[1]+"."+parts[3]+" does not exist")
+			return
+		}
+		f.handleRows(w, r, rows)
+
+	default:
+		f.respond(w, http.StatusNotFound, map[string]interface{}{"status": "FAILURE", "error": "Not found"})
+	}
+}
+
+func (f *FakeMUSIC) handleRows(w http.ResponseWriter, r *http.Request, rows map[string]string) {
+	switch r.Method {
+	case "POST":
+		var body musicRowBody
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || body.Values["key"] == "" {
+			f.fail(w, "Invalid row")
+			return
+		}
+		rows[body.Values["key"]] = body.Values["value"]
+		f.respond(w, http.StatusOK, map[string]interface{}{"status": "SUCCESS"})
+
+	case "GET":
+		var keys []string
+		if key := r.URL.Query().Get("key"); key != "" {
+			if _, ok := rows[key]; ok {
+				keys = append(keys, key)
+			}
+		} else {
+			for key := range rows {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+		}
+
+		result := make(map[string]map[string]string)
+		for i, key := range keys {
+			result["row "+strconv.Itoa(i)] = map[string]string{"key": key, "value": rows[key]}
+		}
+		f.respond(w, http.StatusOK, map[string]interface{}{"status": "SUCCESS", "result": result})
+
+	case "DELETE":
+		delete(rows, r.URL.Query().Get("key"))
+		f.respond(w, http.StatusOK, map[string]interface{}{"status": "SUCCESS"})
+
+	default:
+		f.respond(w, http.StatusMethodNotAllowed, map[string]interface{}{"status": "FAILURE", "error": "Method not allowed"})
+	}
+}
+
+func (f *FakeMUSIC) fail(w http.ResponseWriter, msg string) {
+	f.respond(w, http.StatusBadRequest, map[string]interface{}{"status": "FAILURE", "error": msg})
+}
+
+func (f *FakeMUSIC) respond(w http.ResponseWriter, httpStatus int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(body)
+}
@@ -19,19 +19,32 @@ package api
 import (
 	"errors"
 	consulapi "github.com/hashicorp/consul/api"
-	"os"
+	"sort"
+	"strings"
 )
 
 type ConsulStruct struct {
 	consulClient *consulapi.Client
+	address      string
+}
+
+func init() {
+	RegisterDatastore("consul", NewConsulStruct, []DatastoreConfigOption{
+		{Name: "DATASTORE_IP", Required: true},
+		{Name: "DATASTORE_PORT", Default: "8500"},
+	})
+}
+
+func NewConsulStruct(config DatastoreConfig) DatastoreConnector {
+	return &ConsulStruct{address: config["DATASTORE_IP"] + ":" + config["DATASTORE_PORT"]}
 }
 
 func (c *ConsulStruct) InitializeDatastoreClient() error {
-	if os.Getenv("DATASTORE_IP") == "" {
-		return errors.New("DATASTORE_IP environment variable not set.")
+	if c.address == "" {
+		return errors.New("Consul address not set.")
 	}
 	config := consulapi.DefaultConfig()
-	config.Address = os.Getenv("DATASTORE_IP") + ":8500"
+	config.Address = c.address
 
 	client, err := consulapi.NewClient(config)
 	if err != nil {
@@ -66,37 +79,143 @@ func (c *ConsulStruct) RequestPUT(prefix string, key string, value string) error
 	return nil
 }
 
-func (c *ConsulStruct) RequestGET(prefix string, key string) (string, error) {
+func (c *ConsulStruct) RequestGET(prefix string, key string) (string, bool, error) {
 	key = prefix + key
 
 	kv := c.consulClient.KV()
 
 	pair, _, err := kv.Get(key, nil)
 
-	if pair == nil {
-		return string("No value found for key."), err
+	if err != nil || pair == nil {
+		return "", false, err
 	}
-	return string(pair.Value), err
+	return string(pair.Value), true, nil
 
 }
 
-func (c *ConsulStruct) RequestGETS() ([]string, error) {
-
+/*
+Consul has no paging of its own. With a Limit, only the names of the keys below
+prefix are listed, and values are fetched for the keys of the page alone, see
+getValues.
+*/
+func (c *ConsulStruct) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
 	kv := c.consulClient.KV()
 
-	pairs, _, err := kv.List("", nil)
-
-	if len(pairs) == 0 {
-		return []string{"No keys found."}, err
+	res := []KeyValue{}
+
+	if options.Limit == 0 {
+		pairs, _, err := kv.List(prefix, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, keypair := range pairs {
+			if key, found := options.listedKey(prefix, keypair.Key); found {
+				res = append(res, KeyValue{Key: key, Value: string(keypair.Value)})
+			}
+		}
+		return res, false, nil
 	}
 
-	var res []string
+	// With a separator Consul leaves out the keys nested below prefix.
+	separator := "/"
+	if options.Recursive {
+		separator = ""
+	}
+	keys, _, err := kv.Keys(prefix, separator, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Strings(keys)
+
+	var page []string
+	more := false
+	for _, fullKey := range keys[sort.SearchStrings(keys, prefix+options.After):] {
+		if _, found := options.listedKey(prefix, fullKey); found == false {
+			continue
+		}
+		if options.full(len(page)) {
+			more = true
+			break
+		}
+		page = append(page, fullKey)
+	}
 
-	for _, keypair := range pairs {
-		res = append(res, keypair.Key)
+	values, err := c.getValues(page)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, fullKey := range page {
+		value, found := values[fullKey]
+		// Deleted since the keys were listed.
+		if found == false {
+			continue
+		}
+		key, _ := options.listedKey(prefix, fullKey)
+		res = append(res, KeyValue{Key: key, Value: value})
 	}
 
-	return res, err
+	return res, more, nil
+}
+
+// Consul refuses transactions of more operations.
+const CONSUL_TXN_MAX_OPS = 64
+
+// Consul fails the get of a missing key in a transaction with `key "name" doesn't exist`.
+const CONSUL_TXN_KEY_NOT_FOUND = "doesn't exist"
+
+/*
+getValues gets the values of keys with as few transactions as Consul allows. A
+get of a key that no longer exists rolls the whole transaction back, so those
+keys are left out and the rest is tried again. Any other error is returned.
+*/
+func (c *ConsulStruct) getValues(keys []string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), CONSUL_TXN_MAX_OPS)]
+		keys = keys[len(batch):]
+
+		for len(batch) > 0 {
+			ops := make(consulapi.TxnOps, len(batch))
+			for i, key := range batch {
+				ops[i] = &consulapi.TxnOp{KV: &consulapi.KVTxnOp{Verb: consulapi.KVGet, Key: key}}
+			}
+			ok, resp, _, err := c.consulClient.Txn().Txn(ops, nil)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				for _, result := range resp.Results {
+					if result.KV != nil {
+						values[result.KV.Key] = string(result.KV.Value)
+					}
+				}
+				break
+			}
+			if len(resp.Errors) == 0 {
+				return nil, errors.New("Consul rolled back the transaction without naming an error.")
+			}
+
+			deleted := make(map[int]bool)
+			for _, txnErr := range resp.Errors {
+				if strings.Contains(txnErr.What, CONSUL_TXN_KEY_NOT_FOUND) == false {
+					return nil, errors.New(txnErr.What)
+				}
+				deleted[txnErr.OpIndex] = true
+			}
+			var rest []string
+			for i, key := range batch {
+				if deleted[i] == false {
+					rest = append(rest, key)
+				}
+			}
+			if len(rest) == len(batch) {
+				return nil, errors.New("Consul rolled back the transaction without naming a key of it.")
+			}
+			batch = rest
+		}
+	}
+	return values, nil
 }
 
 func (c *ConsulStruct) RequestDELETE(prefix string, key string) error {
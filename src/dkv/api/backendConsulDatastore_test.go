@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// Starts a FakeConsulServer and points the DATASTORE_* variables at it.
+func startFakeConsulServer() (*httptest.Server, func()) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	oldDatastore_port := os.Getenv("DATASTORE_PORT")
+
+	server := httptest.NewServer(NewFakeConsulServer())
+	u, _ := url.Parse(server.URL)
+
+	os.Setenv("DATASTORE_IP", u.Hostname())
+	os.Setenv("DATASTORE_PORT", u.Port())
+
+	return server, func() {
+		server.Close()
+		os.Setenv("DATASTORE_IP", oldDatastore_ip)
+		os.Setenv("DATASTORE_PORT", oldDatastore_port)
+	}
+}
+
+func TestConsulNewDatastore_noIP(t *testing.T) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	defer os.Setenv("DATASTORE_IP", oldDatastore_ip)
+	os.Setenv("DATASTORE_IP", "")
+
+	_, err := NewDatastore("consul")
+	assert.NotNil(t, err)
+}
+
+func TestConsulConformance(t *testing.T) {
+	_, cleanup := startFakeConsulServer()
+	defer cleanup()
+
+	c := newTestDatastore("consul")
+	err := c.InitializeDatastoreClient()
+	assert.Nil(t, err)
+
+	err = c.CheckDatastoreHealth()
+	assert.Nil(t, err)
+
+	runDatastoreConformance(t, c)
+}
+
+func TestConsulRequestLIST_batched(t *testing.T) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	oldDatastore_port := os.Getenv("DATASTORE_PORT")
+
+	fake := NewFakeConsulServer()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// A key deleted between listing the keys and getting their values.
+		if r.URL.Path == "/v1/txn" {
+			fake.mutex.Lock()
+			delete(fake.kvs, "token1/key050")
+			fake.mutex.Unlock()
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	u, _ := url.Parse(server.URL)
+	os.Setenv("DATASTORE_IP", u.Hostname())
+	os.Setenv("DATASTORE_PORT", u.Port())
+	defer func() {
+		server.Close()
+		os.Setenv("DATASTORE_IP", oldDatastore_ip)
+		os.Setenv("DATASTORE_PORT", oldDatastore_port)
+	}()
+
+	c := newTestDatastore("consul")
+	c.InitializeDatastoreClient()
+	for i := 0; i < 150; i++ {
+		c.RequestPUT("token1/", fmt.Sprintf("key%03d", i), fmt.Sprintf("value%03d", i))
+	}
+
+	requests = 0
+	kvs, more, err := c.RequestLIST("token1/", ListOptions{Limit: 100})
+	assert.Nil(t, err)
+	assert.True(t, more)
+	assert.Len(t, kvs, 99)
+	assert.Equal(t, KeyValue{Key: "key049", Value: "value049"}, kvs[49])
+	assert.Equal(t, KeyValue{Key: "key051", Value: "value051"}, kvs[50])
+	assert.Equal(t, KeyValue{Key: "key099", Value: "value099"}, kvs[98])
+	// The keys, then one transaction per CONSUL_TXN_MAX_OPS keys, one retried without key050.
+	assert.Equal(t, 4, requests)
+}
+
+func TestConsulRequestLIST_txnErrors(t *testing.T) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	oldDatastore_port := os.Getenv("DATASTORE_PORT")
+
+	fake := NewFakeConsulServer()
+	var txnErrors string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/txn" {
+			requests++
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(txnErrors))
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	u, _ := url.Parse(server.URL)
+	os.Setenv("DATASTORE_IP", u.Hostname())
+	os.Setenv("DATASTORE_PORT", u.Port())
+	defer func() {
+		server.Close()
+		os.Setenv("DATASTORE_IP", oldDatastore_ip)
+		os.Setenv("DATASTORE_PORT", oldDatastore_port)
+	}()
+
+	c := newTestDatastore("consul")
+	c.InitializeDatastoreClient()
+	c.RequestPUT("token1/", "key1", "value1")
+	c.RequestPUT("token1/", "key2", "value2")
+
+	txnErrors = `{"Errors": [{"OpIndex": 1, "What": "Permission denied"}]}`
+	_, _, err := c.RequestLIST("token1/", ListOptions{Limit: 10})
+	assert.EqualError(t, err, "Permission denied", "Only missing keys are left out.")
+	assert.Equal(t, 1, requests)
+
+	requests = 0
+	txnErrors = `{"Errors": [{"OpIndex": 5, "What": "key \"token1/key6\" doesn't exist"}]}`
+	_, _, err = c.RequestLIST("token1/", ListOptions{Limit: 10})
+	assert.NotNil(t, err, "A retry without any key left out fails the same way.")
+	assert.Equal(t, 1, requests)
+}
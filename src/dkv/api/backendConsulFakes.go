@@ -0,0 +1,180 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+FakeConsulServer is a local stand-in for the Consul KV HTTP API used by
+ConsulStruct. Unlike FakeConsul it actually stores values, so it can be used to
+run ConsulStruct against the datastore conformance tests. Serve it with
+httptest.NewServer and point DATASTORE_IP/DATASTORE_PORT at it.
+*/
+type FakeConsulServer struct {
+	mutex sync.Mutex
+	kvs   map[string][]byte
+}
+
+type fakeConsulKVPair struct {
+	Key   string
+	Value []byte
+}
+
+type fakeConsulTxnOp struct {
+	KV struct {
+		Verb string
+		Key  string
+	}
+}
+
+type fakeConsulTxnResult struct {
+	KV fakeConsulKVPair
+}
+
+type fakeConsulTxnError struct {
+	OpIndex int
+	What    string
+}
+
+func NewFakeConsulServer() *FakeConsulServer {
+	return &FakeConsulServer{kvs: make(map[string][]byte)}
+}
+
+func (f *FakeConsulServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.URL.Path == "/v1/txn" && r.Method == "PUT" {
+		f.txn(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/kv/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	w.Header().Set("X-Consul-Index", "1")
+	w.Header().Set("X-Consul-LastContact", "0")
+	w.Header().Set("X-Consul-KnownLeader", "true")
+
+	switch r.Method {
+	case "PUT":
+		value, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.kvs[key] = value
+		json.NewEncoder(w).Encode(true)
+
+	case "GET":
+		if _, keys := r.URL.Query()["keys"]; keys {
+			f.listKeys(w, key, r.URL.Query().Get("separator"))
+			return
+		}
+
+		var pairs []fakeConsulKVPair
+		if _, recurse := r.URL.Query()["recurse"]; recurse {
+			for k, v := range f.kvs {
+				if strings.HasPrefix(k, key) {
+					pairs = append(pairs, fakeConsulKVPair{Key: k, Value: v})
+				}
+			}
+			sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		} else if value, found := f.kvs[key]; found {
+			pairs = append(pairs, fakeConsulKVPair{Key: key, Value: value})
+		}
+
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pairs)
+
+	case "DELETE":
+		delete(f.kvs, key)
+		json.NewEncoder(w).Encode(true)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Runs transactions of "get" operations, rolled back as Consul does if a key is missing.
+func (f *FakeConsulServer) txn(w http.ResponseWriter, r *http.Request) {
+	var ops []fakeConsulTxnOp
+	err := json.NewDecoder(r.Body).Decode(&ops)
+	if err != nil || len(ops) > 64 {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var results []fakeConsulTxnResult
+	var errs []fakeConsulTxnError
+	for i, op := range ops {
+		value, found := f.kvs[op.KV.Key]
+		if op.KV.Verb != "get" || found == false {
+			errs = append(errs, fakeConsulTxnError{OpIndex: i, What: "key \"" + op.KV.Key + "\" doesn't exist"})
+			continue
+		}
+		results = append(results, fakeConsulTxnResult{KV: fakeConsulKVPair{Key: op.KV.Key, Value: value}})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Errors": errs})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"Results": results})
+}
+
+// Lists the names of the keys below prefix, those nested past separator folded into one.
+func (f *FakeConsulServer) listKeys(w http.ResponseWriter, prefix string, separator string) {
+	found := make(map[string]bool)
+	for k := range f.kvs {
+		if strings.HasPrefix(k, prefix) == false {
+			continue
+		}
+		if i := strings.Index(k[len(prefix):], separator); separator != "" && i >= 0 {
+			k = k[:len(prefix)+i+len(separator)]
+		}
+		found[k] = true
+	}
+
+	var keys []string
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
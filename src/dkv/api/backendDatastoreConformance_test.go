@@ -0,0 +1,198 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/*
+runDatastoreConformance checks the behaviour every DatastoreConnector must share.
+It expects an initialised and empty datastore. Each backend's own test file
+calls this with a fresh instance.
+*/
+func runDatastoreConformance(t *testing.T, d DatastoreConnector) {
+	t.Run("Empty", func(t *testing.T) {
+		assert.Equal(t, []string{}, listAllKeys(t, d))
+
+		_, found, err := d.RequestGET("token1/", "missing")
+		assert.Nil(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("PutGet", func(t *testing.T) {
+		err := d.RequestPUT("token1/", "key1", "value1")
+		assert.Nil(t, err)
+
+		value, _, err := d.RequestGET("token1/", "key1")
+		assert.Nil(t, err)
+		assert.Equal(t, "value1", value)
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		err := d.RequestPUT("token1/", "key1", "value2")
+		assert.Nil(t, err)
+
+		value, _, err := d.RequestGET("token1/", "key1")
+		assert.Nil(t, err)
+		assert.Equal(t, "value2", value)
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		// The prefix is plainly prepended to the key.
+		err := d.RequestPUT("token1/subdomain1/", "key2", "value3")
+		assert.Nil(t, err)
+
+		value, _, _ := d.RequestGET("token1/", "subdomain1/key2")
+		assert.Equal(t, "value3", value)
+		value, _, _ = d.RequestGET("", "token1/subdomain1/key2")
+		assert.Equal(t, "value3", value)
+
+		// Same key under another prefix is a different key.
+		err = d.RequestPUT("token2/", "key1", "value4")
+		assert.Nil(t, err)
+		value, _, _ = d.RequestGET("token1/", "key1")
+		assert.Equal(t, "value2", value)
+		value, _, _ = d.RequestGET("token2/", "key1")
+		assert.Equal(t, "value4", value)
+	})
+
+	t.Run("SpecialCharacters", func(t *testing.T) {
+		err := d.RequestPUT("token1/", "aai.server.url", "https://aai:8443/a=b c")
+		assert.Nil(t, err)
+
+		value, _, err := d.RequestGET("token1/", "aai.server.url")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://aai:8443/a=b c", value)
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		err := d.RequestPUT("token3/", "empty", "")
+		assert.Nil(t, err)
+
+		value, found, err := d.RequestGET("token3/", "empty")
+		assert.Nil(t, err)
+		assert.True(t, found, "An empty value is not a missing key.")
+		assert.Equal(t, "", value)
+
+		err = d.RequestDELETE("token3/", "empty")
+		assert.Nil(t, err)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"token1/aai.server.url",
+			"token1/key1",
+			"token1/subdomain1/key2",
+			"token2/key1",
+		}, listAllKeys(t, d))
+	})
+
+	t.Run("ListPrefix", func(t *testing.T) {
+		kvs, more, err := d.RequestLIST("token1/", ListOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []KeyValue{
+			{Key: "aai.server.url", Value: "https://aai:8443/a=b c"},
+			{Key: "key1", Value: "value2"},
+		}, kvs, "Keys of subdomains are only listed recursively.")
+		assert.False(t, more)
+
+		kvs, more, err = d.RequestLIST("token1/", ListOptions{Recursive: true})
+		assert.Nil(t, err)
+		assert.Equal(t, []KeyValue{
+			{Key: "aai.server.url", Value: "https://aai:8443/a=b c"},
+			{Key: "key1", Value: "value2"},
+			{Key: "subdomain1/key2", Value: "value3"},
+		}, kvs)
+
+		kvs, _, err = d.RequestLIST("token1/subdomain1/", ListOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []KeyValue{{Key: "key2", Value: "value3"}}, kvs)
+
+		kvs, _, err = d.RequestLIST("token3/", ListOptions{Recursive: true})
+		assert.Nil(t, err)
+		assert.Equal(t, []KeyValue{}, kvs)
+	})
+
+	t.Run("ListPages", func(t *testing.T) {
+		if _, ok := d.(*CassandraStruct); ok {
+			t.Skip("MUSIC cannot page listings.")
+		}
+		options := ListOptions{Recursive: true, Limit: 2}
+		kvs, more, err := d.RequestLIST("token1/", options)
+		assert.Nil(t, err)
+		assert.True(t, more)
+		assert.Equal(t, []KeyValue{
+			{Key: "aai.server.url", Value: "https://aai:8443/a=b c"},
+			{Key: "key1", Value: "value2"},
+		}, kvs)
+
+		options.After = "key1"
+		kvs, more, err = d.RequestLIST("token1/", options)
+		assert.Nil(t, err)
+		assert.False(t, more)
+		assert.Equal(t, []KeyValue{{Key: "subdomain1/key2", Value: "value3"}}, kvs)
+
+		// The page is filled with matching keys only.
+		options = ListOptions{Recursive: true, Limit: 1, Match: func(key string) bool { return key != "aai.server.url" }}
+		kvs, more, err = d.RequestLIST("token1/", options)
+		assert.Nil(t, err)
+		assert.True(t, more)
+		assert.Equal(t, []KeyValue{{Key: "key1", Value: "value2"}}, kvs)
+
+		options = ListOptions{Limit: 1, After: "aai.server.url"}
+		kvs, more, err = d.RequestLIST("token1/", options)
+		assert.Nil(t, err)
+		assert.False(t, more, "Keys of subdomains are not left over.")
+		assert.Equal(t, []KeyValue{{Key: "key1", Value: "value2"}}, kvs)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		err := d.RequestDELETE("token1/", "key1")
+		assert.Nil(t, err)
+
+		_, found, err := d.RequestGET("token1/", "key1")
+		assert.Nil(t, err)
+		assert.False(t, found)
+
+		// Other keys are untouched.
+		value, _, _ := d.RequestGET("token2/", "key1")
+		assert.Equal(t, "value4", value)
+
+		// Deleting a missing key is not an error.
+		err = d.RequestDELETE("token1/", "key1")
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{
+			"token1/aai.server.url",
+			"token1/subdomain1/key2",
+			"token2/key1",
+		}, listAllKeys(t, d))
+	})
+}
+
+// Lists the full names of all keys of d.
+func listAllKeys(t *testing.T, d DatastoreConnector) []string {
+	kvs, _, err := d.RequestLIST("", ListOptions{Recursive: true})
+	assert.Nil(t, err)
+	keys := []string{}
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
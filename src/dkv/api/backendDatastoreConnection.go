@@ -16,12 +16,76 @@
 
 package api
 
-// Interface to have Data Store signature methods.
+import (
+	"strings"
+)
+
+/*
+Interface to have Data Store signature methods. Backends store each key under
+the plain prefix + key string. RequestGET tells apart keys that are missing,
+found being false, from keys whose value is empty.
+*/
 type DatastoreConnector interface {
 	InitializeDatastoreClient() error
 	CheckDatastoreHealth() error
 	RequestPUT(string, string, string) error
-	RequestGET(string, string) (string, error)
-	RequestGETS() ([]string, error)
+	RequestGET(string, string) (string, bool, error)
+	RequestLIST(string, ListOptions) ([]KeyValue, bool, error)
 	RequestDELETE(string, string) error
 }
+
+/*
+KeyValue is a key listed by RequestLIST, relative to the prefix it was listed
+under, and its value.
+*/
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+/*
+ListOptions select the keys RequestLIST returns. Keys are listed sorted, and
+the bool RequestLIST returns tells whether keys are left after the last one
+listed, which is then passed as After for the next page.
+*/
+type ListOptions struct {
+	// Also list the keys nested below the prefix, such as those of subdomains.
+	Recursive bool
+	// Only list keys after After, relative to the prefix.
+	After string
+	// List at most Limit keys, all of them when 0.
+	Limit int
+	// Only list keys Match returns true for, all of them when nil.
+	Match func(string) bool
+}
+
+// listedKey returns fullKey relative to prefix, and whether options list it.
+func (options ListOptions) listedKey(prefix string, fullKey string) (string, bool) {
+	if strings.HasPrefix(fullKey, prefix) == false {
+		return "", false
+	}
+	key := strings.TrimPrefix(fullKey, prefix)
+	if key == "" || key <= options.After {
+		return "", false
+	}
+	if options.Recursive == false && strings.Contains(key, "/") {
+		return "", false
+	}
+	if options.Match != nil && options.Match(key) == false {
+		return "", false
+	}
+	return key, true
+}
+
+// full reports whether a page of n keys holds the Limit.
+func (options ListOptions) full(n int) bool {
+	return options.Limit > 0 && n >= options.Limit
+}
+
+// page cuts listed, sorted kvs down to the Limit and tells whether any were left.
+func (options ListOptions) page(kvs []KeyValue) ([]KeyValue, bool) {
+	if options.full(len(kvs)) && len(kvs) > options.Limit {
+		return kvs[:options.Limit], true
+	}
+	return kvs, false
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+Backends register themselves here from an init() function in their own file,
+so adding a datastore does not require touching Initialise. Packages outside
+this repository can do the same by importing dkv/api and calling
+RegisterDatastore before Initialise runs.
+*/
+
+// DatastoreConfig holds the resolved configuration values of a backend keyed by
+// environment variable name.
+type DatastoreConfig map[string]string
+
+// DatastoreFactory builds a backend from its resolved configuration.
+type DatastoreFactory func(DatastoreConfig) DatastoreConnector
+
+// DatastoreConfigOption describes one environment variable read by a backend.
+type DatastoreConfigOption struct {
+	Name     string
+	Default  string
+	Required bool
+}
+
+type datastoreRegistration struct {
+	factory DatastoreFactory
+	options []DatastoreConfigOption
+}
+
+var (
+	datastoreRegistry      = make(map[string]datastoreRegistration)
+	datastoreRegistryMutex sync.RWMutex
+)
+
+func RegisterDatastore(name string, factory DatastoreFactory, options []DatastoreConfigOption) {
+	datastoreRegistryMutex.Lock()
+	defer datastoreRegistryMutex.Unlock()
+
+	if _, found := datastoreRegistry[name]; found {
+		panic("Datastore " + name + " registered twice.")
+	}
+	datastoreRegistry[name] = datastoreRegistration{factory: factory, options: options}
+}
+
+func SupportedDatastores() []string {
+	datastoreRegistryMutex.RLock()
+	defer datastoreRegistryMutex.RUnlock()
+
+	var names []string
+	for name := range datastoreRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+NewDatastore resolves the configuration schema of the named backend from the
+environment, applying defaults and failing on missing required variables,
+and then hands it to the backend's factory.
+*/
+func NewDatastore(name string) (DatastoreConnector, error) {
+	datastoreRegistryMutex.RLock()
+	registration, found := datastoreRegistry[name]
+	datastoreRegistryMutex.RUnlock()
+
+	if found == false {
+		return nil, errors.New(
+			"Unrecognised Datastore. Supports only " + strings.Join(SupportedDatastores(), ", "))
+	}
+
+	config := make(DatastoreConfig)
+	for _, option := range registration.options {
+		value := os.Getenv(option.Name)
+		if value == "" {
+			if option.Required {
+				return nil, errors.New(option.Name + " environment variable not set.")
+			}
+			value = option.Default
+		}
+		config[option.Name] = value
+	}
+
+	return registration.factory(config), nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// Builds a registered backend from the current environment or panics.
+func newTestDatastore(name string) DatastoreConnector {
+	datastore, err := NewDatastore(name)
+	if err != nil {
+		panic(err)
+	}
+	return datastore
+}
+
+// Registers a backend for the duration of a test.
+func registerTestDatastore(name string, factory DatastoreFactory, options []DatastoreConfigOption) func() {
+	RegisterDatastore(name, factory, options)
+	return func() {
+		datastoreRegistryMutex.Lock()
+		delete(datastoreRegistry, name)
+		datastoreRegistryMutex.Unlock()
+	}
+}
+
+func TestSupportedDatastores(t *testing.T) {
+	names := SupportedDatastores()
+	assert.Equal(t, []string{"cassandra", "consul", "embedded", "etcd", "memory"}, names)
+}
+
+func TestRegisterDatastore_twice(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterDatastore("consul", NewConsulStruct, nil)
+	})
+}
+
+func TestNewDatastore_config(t *testing.T) {
+	var received DatastoreConfig
+	cleanup := registerTestDatastore("test", func(config DatastoreConfig) DatastoreConnector {
+		received = config
+		return &FakeConsul{}
+	}, []DatastoreConfigOption{
+		{Name: "TEST_DATASTORE_REQUIRED", Required: true},
+		{Name: "TEST_DATASTORE_DEFAULT", Default: "default1"},
+		{Name: "TEST_DATASTORE_OPTIONAL"},
+	})
+	defer cleanup()
+
+	defer os.Unsetenv("TEST_DATASTORE_REQUIRED")
+	os.Setenv("TEST_DATASTORE_REQUIRED", "value1")
+
+	datastore, err := NewDatastore("test")
+	assert.Nil(t, err)
+	assert.IsType(t, &FakeConsul{}, datastore)
+	assert.Equal(t, DatastoreConfig{
+		"TEST_DATASTORE_REQUIRED": "value1",
+		"TEST_DATASTORE_DEFAULT":  "default1",
+		"TEST_DATASTORE_OPTIONAL": "",
+	}, received)
+}
+
+func TestNewDatastore_missingRequired(t *testing.T) {
+	cleanup := registerTestDatastore("test", func(config DatastoreConfig) DatastoreConnector {
+		return &FakeConsul{}
+	}, []DatastoreConfigOption{
+		{Name: "TEST_DATASTORE_REQUIRED", Required: true},
+	})
+	defer cleanup()
+
+	_, err := NewDatastore("test")
+	assert.EqualError(t, err, "TEST_DATASTORE_REQUIRED environment variable not set.")
+}
+
+func TestNewDatastore_unknown(t *testing.T) {
+	cleanup := registerTestDatastore("test", func(config DatastoreConfig) DatastoreConnector {
+		return &FakeConsul{}
+	}, nil)
+	defer cleanup()
+
+	_, err := NewDatastore("unknown")
+	assert.EqualError(t, err, "Unrecognised Datastore. Supports only cassandra, consul, embedded, etcd, memory, test")
+}
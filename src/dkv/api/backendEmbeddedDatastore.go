@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EmbeddedStruct keeps key values in a BoltDB file inside DATASTORE_DIR.
+type EmbeddedStruct struct {
+	db        *bolt.DB
+	directory string
+}
+
+const (
+	EMBEDDED_DB_FILE = "dkv.db"
+	EMBEDDED_BUCKET  = "dkv"
+)
+
+func init() {
+	RegisterDatastore("embedded", NewEmbeddedStruct, []DatastoreConfigOption{
+		{Name: "DATASTORE_DIR", Required: true},
+	})
+}
+
+func NewEmbeddedStruct(config DatastoreConfig) DatastoreConnector {
+	return &EmbeddedStruct{directory: config["DATASTORE_DIR"]}
+}
+
+func (e *EmbeddedStruct) InitializeDatastoreClient() error {
+	if e.directory == "" {
+		return errors.New("Embedded datastore directory not set.")
+	}
+
+	err := os.MkdirAll(e.directory, os.FileMode(0770))
+	if err != nil {
+		return err
+	}
+
+	// Timeout makes sure a second dkv process pointed at the same directory
+	// fails instead of blocking forever on the file lock.
+	db, err := bolt.Open(
+		filepath.Join(e.directory, EMBEDDED_DB_FILE), 0660, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(EMBEDDED_BUCKET))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	e.db = db
+
+	return nil
+}
+
+func (e *EmbeddedStruct) CheckDatastoreHealth() error {
+	err := e.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(EMBEDDED_BUCKET)) == nil {
+			return errors.New("bucket missing")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.New("[ERROR] Cannot talk to Datastore. Check if it is running/reachable.")
+	}
+	return nil
+}
+
+func (e *EmbeddedStruct) RequestPUT(prefix string, key string, value string) error {
+	key = prefix + key
+
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(EMBEDDED_BUCKET)).Put([]byte(key), []byte(value))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *EmbeddedStruct) RequestGET(prefix string, key string) (string, bool, error) {
+	key = prefix + key
+
+	var value []byte
+
+	err := e.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(EMBEDDED_BUCKET)).Get([]byte(key))
+		if v != nil {
+			// Bolt values are only valid inside the transaction.
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+
+	if err != nil || value == nil {
+		return "", false, err
+	}
+	return string(value), true, nil
+}
+
+// Bolt keeps keys sorted, so the cursor only walks the keys of the page.
+func (e *EmbeddedStruct) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
+	res := []KeyValue{}
+	more := false
+
+	err := e.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(EMBEDDED_BUCKET)).Cursor()
+		for k, v := c.Seek([]byte(prefix + options.After)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			key, found := options.listedKey(prefix, string(k))
+			if found == false {
+				continue
+			}
+			if options.full(len(res)) {
+				more = true
+				break
+			}
+			res = append(res, KeyValue{Key: key, Value: string(v)})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+	return res, more, nil
+}
+
+func (e *EmbeddedStruct) RequestDELETE(prefix string, key string) error {
+	key = prefix + key
+
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(EMBEDDED_BUCKET)).Delete([]byte(key))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
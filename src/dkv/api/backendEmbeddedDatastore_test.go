@@ -0,0 +1,110 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Points DATASTORE_DIR at a fresh temporary directory.
+func setupEmbeddedDir() func() {
+	oldDatastore_dir := os.Getenv("DATASTORE_DIR")
+	dir, _ := ioutil.TempDir("", "dkv-embedded")
+	os.Setenv("DATASTORE_DIR", dir)
+
+	return func() {
+		os.RemoveAll(dir)
+		os.Setenv("DATASTORE_DIR", oldDatastore_dir)
+	}
+}
+
+func TestEmbeddedNewDatastore_noDir(t *testing.T) {
+	oldDatastore_dir := os.Getenv("DATASTORE_DIR")
+	defer os.Setenv("DATASTORE_DIR", oldDatastore_dir)
+	os.Setenv("DATASTORE_DIR", "")
+
+	_, err := NewDatastore("embedded")
+	assert.NotNil(t, err)
+}
+
+func TestEmbeddedRequests(t *testing.T) {
+	cleanup := setupEmbeddedDir()
+	defer cleanup()
+
+	e := newTestDatastore("embedded").(*EmbeddedStruct)
+	err := e.InitializeDatastoreClient()
+	assert.Nil(t, err)
+	defer e.db.Close()
+
+	err = e.CheckDatastoreHealth()
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{}, listAllKeys(t, e))
+
+	err = e.RequestPUT("token1/", "key1", "value1")
+	assert.Nil(t, err)
+	err = e.RequestPUT("token1/subdomain1/", "key2", "value2")
+	assert.Nil(t, err)
+
+	value, _, err := e.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", value)
+
+	assert.Equal(t, []string{"token1/key1", "token1/subdomain1/key2"}, listAllKeys(t, e))
+
+	err = e.RequestDELETE("token1/", "key1")
+	assert.Nil(t, err)
+
+	_, found, err := e.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestEmbeddedConformance(t *testing.T) {
+	cleanup := setupEmbeddedDir()
+	defer cleanup()
+
+	e := newTestDatastore("embedded").(*EmbeddedStruct)
+	err := e.InitializeDatastoreClient()
+	assert.Nil(t, err)
+	defer e.db.Close()
+
+	runDatastoreConformance(t, e)
+}
+
+func TestEmbeddedRequests_persisted(t *testing.T) {
+	cleanup := setupEmbeddedDir()
+	defer cleanup()
+
+	e := newTestDatastore("embedded").(*EmbeddedStruct)
+	e.InitializeDatastoreClient()
+	e.RequestPUT("token1/", "key1", "value1")
+	e.db.Close()
+
+	// Values must survive a restart of the process.
+	e = newTestDatastore("embedded").(*EmbeddedStruct)
+	err := e.InitializeDatastoreClient()
+	assert.Nil(t, err)
+	defer e.db.Close()
+
+	value, _, err := e.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", value)
+}
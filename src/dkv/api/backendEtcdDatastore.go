@@ -0,0 +1,169 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"time"
+)
+
+// EtcdStruct keeps key values in an etcd v3 cluster, below rootPrefix.
+type EtcdStruct struct {
+	etcdClient *clientv3.Client
+	endpoint   string
+	rootPrefix string
+}
+
+const (
+	ETCD_DEFAULT_PORT        = "2379"
+	ETCD_DEFAULT_ROOT_PREFIX = "dkv/"
+	ETCD_REQUEST_TIMEOUT     = 5 * time.Second
+)
+
+func init() {
+	RegisterDatastore("etcd", NewEtcdStruct, []DatastoreConfigOption{
+		{Name: "DATASTORE_IP", Required: true},
+		{Name: "DATASTORE_PORT", Default: ETCD_DEFAULT_PORT},
+		{Name: "ETCD_ROOT_PREFIX", Default: ETCD_DEFAULT_ROOT_PREFIX},
+	})
+}
+
+func NewEtcdStruct(config DatastoreConfig) DatastoreConnector {
+	return &EtcdStruct{
+		endpoint:   config["DATASTORE_IP"] + ":" + config["DATASTORE_PORT"],
+		rootPrefix: config["ETCD_ROOT_PREFIX"],
+	}
+}
+
+func (e *EtcdStruct) InitializeDatastoreClient() error {
+	if e.endpoint == "" {
+		return errors.New("etcd endpoint not set.")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{e.endpoint},
+		DialTimeout: ETCD_REQUEST_TIMEOUT,
+	})
+	if err != nil {
+		return err
+	}
+	e.etcdClient = client
+
+	return nil
+}
+
+func (e *EtcdStruct) CheckDatastoreHealth() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ETCD_REQUEST_TIMEOUT)
+	defer cancel()
+
+	for _, endpoint := range e.etcdClient.Endpoints() {
+		_, err := e.etcdClient.Status(ctx, endpoint)
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.New("[ERROR] Cannot talk to Datastore. Check if it is running/reachable.")
+}
+
+func (e *EtcdStruct) RequestPUT(prefix string, key string, value string) error {
+	key = e.rootPrefix + prefix + key
+
+	ctx, cancel := context.WithTimeout(context.Background(), ETCD_REQUEST_TIMEOUT)
+	defer cancel()
+
+	_, err := e.etcdClient.Put(ctx, key, value)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *EtcdStruct) RequestGET(prefix string, key string) (string, bool, error) {
+	key = e.rootPrefix + prefix + key
+
+	ctx, cancel := context.WithTimeout(context.Background(), ETCD_REQUEST_TIMEOUT)
+	defer cancel()
+
+	resp, err := e.etcdClient.Get(ctx, key)
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+	return string(resp.Kvs[0].Value), true, nil
+}
+
+// RequestLIST reads the range below prefix in batches, going on while Match leaves a page short.
+func (e *EtcdStruct) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
+	fullPrefix := e.rootPrefix + prefix
+	start := fullPrefix + options.After
+	end := clientv3.GetPrefixRangeEnd(fullPrefix)
+
+	getOptions := []clientv3.OpOption{clientv3.WithRange(end), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend)}
+	if options.Limit > 0 {
+		// One more than the page, to know whether keys are left.
+		getOptions = append(getOptions, clientv3.WithLimit(int64(options.Limit+1)))
+	}
+
+	res := []KeyValue{}
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), ETCD_REQUEST_TIMEOUT)
+		resp, err := e.etcdClient.Get(ctx, start, getOptions...)
+		cancel()
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, kv := range resp.Kvs {
+			key, found := options.listedKey(fullPrefix, string(kv.Key))
+			if found == false {
+				continue
+			}
+			if options.full(len(res)) {
+				return res, true, nil
+			}
+			res = append(res, KeyValue{Key: key, Value: string(kv.Value)})
+		}
+
+		if resp.More == false || len(resp.Kvs) == 0 {
+			return res, false, nil
+		}
+		start = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+func (e *EtcdStruct) RequestDELETE(prefix string, key string) error {
+	key = e.rootPrefix + prefix + key
+
+	ctx, cancel := context.WithTimeout(context.Background(), ETCD_REQUEST_TIMEOUT)
+	defer cancel()
+
+	_, err := e.etcdClient.Delete(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/server/v3/embed"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func freePort() int {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// Starts an embedded etcd server and points the DATASTORE_* variables at it.
+func startEmbeddedEtcd(t *testing.T) func() {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	oldDatastore_port := os.Getenv("DATASTORE_PORT")
+
+	dir, _ := ioutil.TempDir("", "dkv-etcd")
+	clientPort := strconv.Itoa(freePort())
+	peerURL, _ := url.Parse("http://127.0.0.1:" + strconv.Itoa(freePort()))
+	clientURL, _ := url.Parse("http://127.0.0.1:" + clientPort)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	cfg.ListenPeerUrls = []url.URL{*peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{*peerURL}
+	cfg.ListenClientUrls = []url.URL{*clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{*clientURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		server.Close()
+		t.Fatal("Embedded etcd took too long to start.")
+	}
+
+	os.Setenv("DATASTORE_IP", "127.0.0.1")
+	os.Setenv("DATASTORE_PORT", clientPort)
+
+	return func() {
+		server.Close()
+		os.RemoveAll(dir)
+		os.Setenv("DATASTORE_IP", oldDatastore_ip)
+		os.Setenv("DATASTORE_PORT", oldDatastore_port)
+	}
+}
+
+func TestEtcdNewDatastore_noIP(t *testing.T) {
+	oldDatastore_ip := os.Getenv("DATASTORE_IP")
+	defer os.Setenv("DATASTORE_IP", oldDatastore_ip)
+	os.Setenv("DATASTORE_IP", "")
+
+	_, err := NewDatastore("etcd")
+	assert.NotNil(t, err)
+}
+
+func TestEtcdCheckDatastoreHealth(t *testing.T) {
+	cleanup := startEmbeddedEtcd(t)
+	defer cleanup()
+
+	e := newTestDatastore("etcd").(*EtcdStruct)
+	err := e.InitializeDatastoreClient()
+	assert.Nil(t, err)
+	defer e.etcdClient.Close()
+
+	err = e.CheckDatastoreHealth()
+	assert.Nil(t, err)
+}
+
+func TestEtcdRequests(t *testing.T) {
+	cleanup := startEmbeddedEtcd(t)
+	defer cleanup()
+
+	oldRootPrefix := os.Getenv("ETCD_ROOT_PREFIX")
+	defer os.Setenv("ETCD_ROOT_PREFIX", oldRootPrefix)
+	os.Setenv("ETCD_ROOT_PREFIX", "test/dkv/")
+
+	e := newTestDatastore("etcd").(*EtcdStruct)
+	e.InitializeDatastoreClient()
+	defer e.etcdClient.Close()
+
+	assert.Equal(t, []string{}, listAllKeys(t, e))
+
+	err := e.RequestPUT("token1/", "key1", "value1")
+	assert.Nil(t, err)
+	err = e.RequestPUT("token1/subdomain1/", "key2", "value2")
+	assert.Nil(t, err)
+
+	value, _, err := e.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", value)
+
+	// Keys are listed relative to the root prefix.
+	assert.Equal(t, []string{"token1/key1", "token1/subdomain1/key2"}, listAllKeys(t, e))
+
+	err = e.RequestDELETE("token1/", "key1")
+	assert.Nil(t, err)
+
+	_, found, err := e.RequestGET("token1/", "key1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestEtcdConformance(t *testing.T) {
+	cleanup := startEmbeddedEtcd(t)
+	defer cleanup()
+
+	e := newTestDatastore("etcd").(*EtcdStruct)
+	err := e.InitializeDatastoreClient()
+	assert.Nil(t, err)
+	defer e.etcdClient.Close()
+
+	runDatastoreConformance(t, e)
+}
+
+func TestInitialise_etcd(t *testing.T) {
+	oldDatastore_type := os.Getenv("DATASTORE")
+	oldMOUNTPATH := os.Getenv("MOUNTPATH")
+
+	cleanup := startEmbeddedEtcd(t)
+	os.Setenv("DATASTORE", "etcd")
+
+	defer func() {
+		cleanup()
+		os.Setenv("DATASTORE", oldDatastore_type)
+		os.Setenv("MOUNTPATH", oldMOUNTPATH)
+	}()
+
+	err := Initialise()
+	assert.Nil(t, err)
+	Datastore.(*EtcdStruct).etcdClient.Close()
+}
@@ -17,18 +17,26 @@
 package api
 
 import (
-	"errors"
 	uuid "github.com/hashicorp/go-uuid"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
+	"sort"
 )
 
 type DirectoryOperationer interface {
 	// Service Operations.
-	CreateService(CreateRegisterServiceBody) (string, error)
+	CreateService(CreateRegisterServiceBody) (string, string, error)
 	RemoveService(string) error
+	SetServiceCredential(string, string, string) (string, error)
+	RemoveServiceCredential(string, string) error
+	ListServiceCredentials(string) ([]CredentialInfo, bool, error)
 	CreateServiceSubdomain(string, string) error
 	RemoveServiceSubdomain(string, string) error
+	ListServices() ([]ServiceInfo, error)
+	GetServiceInfo(string) (ServiceInfo, bool, error)
+	ListServiceSubdomains(string) ([]SubdomainInfo, bool, error)
 	// Directory Operations.
 	CreateDirectory(string) error
 	RemoveDirectory(string) error
@@ -36,59 +44,159 @@ type DirectoryOperationer interface {
 	RemoveFile(string, string, string) error
 	FindService(string) (string, bool, error)
 	FetchFile(http.ResponseWriter, *http.Request, string, string, string)
-	CreateFile(string) (*os.File, error)
+	CreateFile(string, string, string) (*os.File, error)
 }
 
 type DirectoryStruct struct {
 	directory string
 }
 
+type ServiceInfo struct {
+	Token      string `json:"token"`
+	Service    string `json:"service"`
+	CreatedAt  string `json:"created_at"`
+	Subdomains int    `json:"subdomains"`
+}
+
+// CredentialInfo is what is shown of a Credential. The secret hash never leaves the registry.
+type CredentialInfo struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type SubdomainInfo struct {
+	Subdomain string   `json:"subdomain"`
+	Files     []string `json:"files"`
+}
+
 /*
-TODO(sshank): This needs to be made completely stateless or else each container running this API will not have
-same data in token_service_map.json
+Only used when REGISTRY=file, or to import an existing file into the datastore
+registry. With the file registry each container running this API has its own
+token_service_map.json.
 */
 const (
 	JSONPATH = "api/token_service_map.json"
 )
 
+// Name of the admin credential issued when a service is created.
+const OWNER_CREDENTIAL = "owner"
+
 var MOUNTPATH = ""
 
-func (d *DirectoryStruct) CreateService(body CreateRegisterServiceBody) (string, error) {
+/*
+CreateService registers a new service and returns its token and the secret of
+its owner credential, which has the admin role. The token names the service in
+paths and may be shared; the secret authenticates requests for it and is only
+ever returned here.
+*/
+func (d *DirectoryStruct) CreateService(body CreateRegisterServiceBody) (string, string, error) {
 
 	// Having same name is prohibited?
-	found, err := FindServiceInJSON(JSONPATH, body.Domain)
+	found, err := Registry.FindServiceName(body.Domain)
 	if err != nil {
-		return "", err
+		return "", "", DatastoreError(err)
 	}
 	if found {
-		return "", errors.New("Service already found. Check name.")
+		return "", "", ConflictError("Service already found. Check name.")
 	}
 
 	token, err := uuid.GenerateUUID()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
 	}
 
 	err = d.CreateDirectory(token)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	err = WriteJSON(JSONPATH, token, body.Domain)
+	err = Registry.AddService(token, body.Domain)
+	if err != nil {
+		d.undoCreateService(token, false)
+		return "", "", DatastoreError(err)
+	}
 
+	err = Registry.SetCredential(token, Credential{
+		Name:       OWNER_CREDENTIAL,
+		Role:       ROLE_ADMIN,
+		SecretHash: HashSecret(secret),
+	})
+	if err != nil {
+		d.undoCreateService(token, true)
+		return "", "", DatastoreError(err)
+	}
+	return token, secret, nil
+}
+
+// undoCreateService removes what CreateService did before failing, so the name can be registered again.
+func (d *DirectoryStruct) undoCreateService(token string, registered bool) {
+	if registered {
+		err := Registry.DeleteService(token)
+		if err != nil {
+			log.Println("[ERROR] Could not unregister service", token, "after a failed registration:", err)
+		}
+	}
+	err := d.RemoveDirectory(token)
+	if err != nil {
+		log.Println("[ERROR] Could not remove directory of service", token, "after a failed registration:", err)
+	}
+}
+
+/*
+SetServiceCredential creates the named credential of a service with a new
+secret, or replaces the role and secret of an existing one, and returns the
+secret.
+*/
+func (d *DirectoryStruct) SetServiceCredential(token string, name string, role string) (string, error) {
+	foundToken, err := Registry.FindToken(token)
+	if err != nil {
+		return "", DatastoreError(err)
+	}
+	if foundToken == false {
+		return "", NotFoundError("Token not found. Please check token or if service is created.")
+	}
+
+	secret, err := GenerateSecret()
 	if err != nil {
 		return "", err
 	}
-	return token, nil
+
+	err = Registry.SetCredential(token, Credential{Name: name, Role: role, SecretHash: HashSecret(secret)})
+	if err != nil {
+		return "", DatastoreError(err)
+	}
+	return secret, nil
+}
+
+func (d *DirectoryStruct) RemoveServiceCredential(token string, name string) error {
+	return DatastoreError(Registry.DeleteCredential(token, name))
+}
+
+func (d *DirectoryStruct) ListServiceCredentials(token string) ([]CredentialInfo, bool, error) {
+	credentials, found, err := Registry.GetCredentials(token)
+	if err != nil || found == false {
+		return nil, false, DatastoreError(err)
+	}
+
+	infos := []CredentialInfo{}
+	for _, credential := range credentials {
+		infos = append(infos, CredentialInfo{Name: credential.Name, Role: credential.Role})
+	}
+	return infos, true, nil
 }
 
 func (d *DirectoryStruct) CreateServiceSubdomain(token string, subdomain string) error {
-	foundToken, err := FindTokenInJSON(JSONPATH, token)
+	foundToken, err := Registry.FindToken(token)
 	if err != nil {
-		return err
+		return DatastoreError(err)
 	}
 	if foundToken == false {
-		return errors.New("Token not found. Please check token or if service is created.")
+		return NotFoundError("Token not found. Please check token or if service is created.")
 	}
 	err = d.CreateSubDirectory(token, subdomain)
 	if err != nil {
@@ -98,9 +206,9 @@ func (d *DirectoryStruct) CreateServiceSubdomain(token string, subdomain string)
 }
 
 func (d *DirectoryStruct) RemoveService(token string) error {
-	err := DeleteInJSON(JSONPATH, token)
+	err := Registry.DeleteService(token)
 	if err != nil {
-		return err
+		return DatastoreError(err)
 	}
 	err = d.RemoveDirectory(token)
 	if err != nil {
@@ -110,20 +218,20 @@ func (d *DirectoryStruct) RemoveService(token string) error {
 }
 
 func (d *DirectoryStruct) FindService(token string) (string, bool, error) {
-	service, found, err := GetServicebyToken(JSONPATH, token)
+	service, found, err := Registry.GetServiceByToken(token)
 	if err != nil {
-		return "", false, err
+		return "", false, DatastoreError(err)
 	}
 	return service, found, nil
 }
 
 func (d *DirectoryStruct) RemoveServiceSubdomain(token string, subdomain string) error {
-	foundToken, err := FindTokenInJSON(JSONPATH, token)
+	foundToken, err := Registry.FindToken(token)
 	if err != nil {
-		return err
+		return DatastoreError(err)
 	}
 	if foundToken == false {
-		return errors.New("Token not found. Please check token or if service is created.")
+		return NotFoundError("Token not found. Please check token or if service is created.")
 	}
 	err = d.RemoveSubDirectory(token, subdomain)
 	if err != nil {
@@ -132,72 +240,212 @@ func (d *DirectoryStruct) RemoveServiceSubdomain(token string, subdomain string)
 	return nil
 }
 
+func (d *DirectoryStruct) ListServices() ([]ServiceInfo, error) {
+	var services []ServiceInfo
+
+	tsm_list, err := Registry.ListServices()
+	if err != nil {
+		return services, DatastoreError(err)
+	}
+
+	for _, tsm := range tsm_list {
+		info, err := d.serviceInfo(tsm)
+		if err != nil {
+			return services, err
+		}
+		services = append(services, info)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Service < services[j].Service })
+	return services, nil
+}
+
+// GetServiceInfo is the ServiceInfo of a single service, found is false if token is not registered.
+func (d *DirectoryStruct) GetServiceInfo(token string) (ServiceInfo, bool, error) {
+	tsm, found, err := Registry.GetService(token)
+	if err != nil || found == false {
+		return ServiceInfo{}, false, DatastoreError(err)
+	}
+	info, err := d.serviceInfo(tsm)
+	if err != nil {
+		return ServiceInfo{}, true, err
+	}
+	return info, true, nil
+}
+
+func (d *DirectoryStruct) serviceInfo(tsm Token_service_map) (ServiceInfo, error) {
+	subdomains, err := d.readSubdomains(tsm.Token)
+	if err != nil {
+		return ServiceInfo{}, err
+	}
+	return ServiceInfo{
+		Token:      tsm.Token,
+		Service:    tsm.Service,
+		CreatedAt:  tsm.CreatedAt,
+		Subdomains: len(subdomains),
+	}, nil
+}
+
+func (d *DirectoryStruct) ListServiceSubdomains(token string) ([]SubdomainInfo, bool, error) {
+	var subdomains []SubdomainInfo
+
+	foundToken, err := Registry.FindToken(token)
+	if err != nil || foundToken == false {
+		return subdomains, false, DatastoreError(err)
+	}
+
+	names, err := d.readSubdomains(token)
+	if err != nil {
+		return subdomains, true, err
+	}
+
+	for _, name := range names {
+		dir, err := MountPath(token, name, "")
+		if err != nil {
+			return subdomains, true, err
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return subdomains, true, FilesystemError(err, "Subdomain "+name)
+		}
+		files := []string{}
+		for _, entry := range entries {
+			if entry.IsDir() == false {
+				files = append(files, entry.Name())
+			}
+		}
+		subdomains = append(subdomains, SubdomainInfo{Subdomain: name, Files: files})
+	}
+	return subdomains, true, nil
+}
+
+/*
+readSubdomains returns the sorted subdomain directories of a service. A service
+registered by another replica may not have a directory on this mount yet, which
+is treated as having no subdomains.
+*/
+func (d *DirectoryStruct) readSubdomains(token string) ([]string, error) {
+	var names []string
+
+	dir, err := MountPath(token, "", "")
+	if err != nil {
+		return names, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return names, FilesystemError(err, "Directory of service with token "+token)
+	}
+
+	// ReadDir already sorts by name.
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+/*
+The methods below only reach the mount through MountPath, which rejects names
+and symlinks that would lead outside of it.
+*/
 func (d *DirectoryStruct) CreateDirectory(token string) error {
-	// Permissions inside mount point?
-	err := os.Mkdir(MOUNTPATH+token, os.FileMode(0770))
+	dir, err := MountPath(token, "", "")
 	if err != nil {
 		return err
 	}
+	// Permissions inside mount point?
+	err = os.Mkdir(dir, os.FileMode(0770))
+	if err != nil {
+		return FilesystemError(err, "Directory of service")
+	}
 	return nil
 }
 
 func (d *DirectoryStruct) CreateSubDirectory(token string, subdomain string) error {
-	err := os.Mkdir(MOUNTPATH+token+"/"+subdomain, os.FileMode(0770))
+	dir, err := MountPath(token, subdomain, "")
 	if err != nil {
 		return err
 	}
+	err = os.Mkdir(dir, os.FileMode(0770))
+	if err != nil {
+		return FilesystemError(err, "Subdomain "+subdomain)
+	}
 	return nil
 }
 
 func (d *DirectoryStruct) RemoveDirectory(token string) error {
-	err := os.RemoveAll(MOUNTPATH + token)
+	dir, err := MountPath(token, "", "")
 	if err != nil {
 		return err
 	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return FilesystemError(err, "Directory of service")
+	}
 	return nil
 }
 
 func (d *DirectoryStruct) RemoveSubDirectory(token string, subdomain string) error {
-	err := os.RemoveAll(MOUNTPATH + token + "/" + subdomain)
+	if subdomain == "" {
+		return InvalidError("Invalid subdomain.")
+	}
+	dir, err := MountPath(token, subdomain, "")
 	if err != nil {
 		return err
 	}
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return FilesystemError(err, "Subdomain "+subdomain)
+	}
 	return nil
 }
 
 func (d *DirectoryStruct) RemoveFile(token string, subdomain string, filename string) error {
-	var filepath = ""
-	if subdomain != "" {
-		filepath += MOUNTPATH + token + "/" + subdomain + "/" + filename
-	} else {
-		filepath += MOUNTPATH + token + "/" + filename
+	if filename == "" {
+		return InvalidError("Invalid filename.")
 	}
-	// If error, it seems to show the mounthpath back to the client. This is not good
-	// error return practise. It shoudn't return the exact file path on the system.
-	err := os.Remove(filepath)
+	filepath, err := MountPath(token, subdomain, filename)
 	if err != nil {
 		return err
 	}
+	err = os.Remove(filepath)
+	if err != nil {
+		return FilesystemError(err, "File "+filename)
+	}
 	return nil
 }
 
 func (d *DirectoryStruct) FetchFile(
 	w http.ResponseWriter, r *http.Request, token string, subdomain string, filename string) {
 
-	var filepath = ""
-	if subdomain != "" {
-		filepath += MOUNTPATH + token + "/" + subdomain + "/" + filename
-	} else {
-		filepath += MOUNTPATH + token + "/" + filename
+	if filename == "" {
+		GenerateErrorResponse(w, r, InvalidError("Invalid filename."))
+		return
+	}
+	filepath, err := MountPath(token, subdomain, filename)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
 	}
 
 	http.ServeFile(w, r, filepath)
 }
 
-func (d *DirectoryStruct) CreateFile(filepath string) (*os.File, error) {
-	f, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY, 0770)
+func (d *DirectoryStruct) CreateFile(token string, subdomain string, filename string) (*os.File, error) {
+	if filename == "" {
+		return nil, InvalidError("Invalid filename.")
+	}
+	filepath, err := MountPath(token, subdomain, filename)
 	if err != nil {
 		return nil, err
 	}
+	f, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY, 0770)
+	if err != nil {
+		return nil, FilesystemError(err, "Directory of file "+filename)
+	}
 	return f, nil
 }
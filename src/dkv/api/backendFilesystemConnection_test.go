@@ -0,0 +1,240 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Points MOUNTPATH at a fresh temporary directory and the Registry at the memory Datastore.
+func setupMountpath() func() {
+	oldMOUNTPATH := MOUNTPATH
+	oldRegistry := Registry
+
+	dir, _ := ioutil.TempDir("", "dkv-mountpath")
+	MOUNTPATH = dir + "/"
+	cleanupDatastore := setupMemoryDatastore()
+	Registry = &DatastoreRegistryStruct{}
+
+	return func() {
+		cleanupDatastore()
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+		Registry = oldRegistry
+	}
+}
+
+func TestDirectoryListServices(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	d := &DirectoryStruct{}
+	token1, _, err := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+	assert.Nil(t, err)
+	token2, _, err := d.CreateService(CreateRegisterServiceBody{Domain: "service2"})
+	assert.Nil(t, err)
+	d.CreateServiceSubdomain(token1, "subdomain1")
+	d.CreateServiceSubdomain(token1, "subdomain2")
+	// Config files at the top of a service are not subdomains.
+	ioutil.WriteFile(MOUNTPATH+token1+"/config.properties", []byte("a=b"), 0660)
+
+	services, err := d.ListServices()
+	assert.Nil(t, err)
+	assert.Len(t, services, 2)
+	assert.Equal(t, token1, services[0].Token)
+	assert.Equal(t, "service1", services[0].Service)
+	assert.Equal(t, 2, services[0].Subdomains)
+	assert.NotEmpty(t, services[0].CreatedAt)
+	assert.Equal(t, token2, services[1].Token)
+	assert.Equal(t, 0, services[1].Subdomains)
+
+	info, found, err := d.GetServiceInfo(token1)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, services[0], info)
+
+	_, found, err = d.GetServiceInfo("token3")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestDirectoryListServices_noDirectory(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	// Registered by another replica with its own mount.
+	Registry.AddService("token1", "service1")
+
+	d := &DirectoryStruct{}
+	services, err := d.ListServices()
+	assert.Nil(t, err)
+	assert.Equal(t, []ServiceInfo{{Token: "token1", Service: "service1",
+		CreatedAt: services[0].CreatedAt, Subdomains: 0}}, services)
+}
+
+func TestDirectoryListServiceSubdomains(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	d := &DirectoryStruct{}
+	token, _, _ := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+	d.CreateServiceSubdomain(token, "subdomain1")
+	d.CreateServiceSubdomain(token, "subdomain2")
+	ioutil.WriteFile(MOUNTPATH+token+"/subdomain1/b.properties", []byte("a=b"), 0660)
+	ioutil.WriteFile(MOUNTPATH+token+"/subdomain1/a.properties", []byte("a=b"), 0660)
+
+	subdomains, found, err := d.ListServiceSubdomains(token)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []SubdomainInfo{
+		{Subdomain: "subdomain1", Files: []string{"a.properties", "b.properties"}},
+		{Subdomain: "subdomain2", Files: []string{}},
+	}, subdomains)
+}
+
+func TestDirectoryListServiceSubdomains_notFound(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	d := &DirectoryStruct{}
+	subdomains, found, err := d.ListServiceSubdomains("token1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Empty(t, subdomains)
+}
+
+func TestDirectoryCreateService_owner(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	d := &DirectoryStruct{}
+	token, secret, err := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, secret)
+	assert.NotEqual(t, token, secret)
+
+	credentials, found, err := Registry.GetCredentials(token)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []Credential{
+		{Name: OWNER_CREDENTIAL, Role: ROLE_ADMIN, SecretHash: HashSecret(secret)},
+	}, credentials)
+}
+
+func TestDirectoryCreateService_err(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	oldDatastore := Datastore
+	Datastore = &FakeConsulErr{}
+	defer func() { Datastore = oldDatastore }()
+
+	d := &DirectoryStruct{}
+	_, _, err := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+	assert.Equal(t, ERROR_BACKEND_UNAVAILABLE, ErrorCode(err))
+
+	_, _, err = d.ListServiceSubdomains("token1")
+	assert.Equal(t, ERROR_BACKEND_UNAVAILABLE, ErrorCode(err))
+}
+
+// failingRegistry fails the registry call named by fail.
+type failingRegistry struct {
+	*DatastoreRegistryStruct
+	fail string
+}
+
+func (f *failingRegistry) AddService(token string, service string) error {
+	if f.fail == "AddService" {
+		return errors.New("Internal Server Error")
+	}
+	return f.DatastoreRegistryStruct.AddService(token, service)
+}
+
+func (f *failingRegistry) SetCredential(token string, credential Credential) error {
+	if f.fail == "SetCredential" {
+		return errors.New("Internal Server Error")
+	}
+	return f.DatastoreRegistryStruct.SetCredential(token, credential)
+}
+
+func TestDirectoryCreateService_undo(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	d := &DirectoryStruct{}
+	for _, fail := range []string{"AddService", "SetCredential"} {
+		Registry = &failingRegistry{DatastoreRegistryStruct: &DatastoreRegistryStruct{}, fail: fail}
+
+		_, _, err := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+		assert.Equal(t, ERROR_BACKEND_UNAVAILABLE, ErrorCode(err), fail)
+
+		services, _ := Registry.ListServices()
+		assert.Empty(t, services, "%s: the service is not left registered.", fail)
+		entries, _ := ioutil.ReadDir(MOUNTPATH)
+		assert.Empty(t, entries, "%s: the directory of the service is removed.", fail)
+	}
+
+	// The name is free again.
+	Registry = &DatastoreRegistryStruct{}
+	_, _, err := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+	assert.Nil(t, err)
+}
+
+func TestDirectoryServiceCredentials(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	d := &DirectoryStruct{}
+	token, _, _ := d.CreateService(CreateRegisterServiceBody{Domain: "service1"})
+
+	secret, err := d.SetServiceCredential(token, "ci", ROLE_WRITER)
+	assert.Nil(t, err)
+	_, err = d.SetServiceCredential(token, "pods", ROLE_READ_ONLY)
+	assert.Nil(t, err)
+
+	// Setting it again rotates the secret.
+	rotated, err := d.SetServiceCredential(token, "ci", ROLE_WRITER)
+	assert.Nil(t, err)
+	assert.NotEqual(t, secret, rotated)
+
+	infos, found, err := d.ListServiceCredentials(token)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []CredentialInfo{
+		{Name: OWNER_CREDENTIAL, Role: ROLE_ADMIN},
+		{Name: "ci", Role: ROLE_WRITER},
+		{Name: "pods", Role: ROLE_READ_ONLY},
+	}, infos)
+
+	err = d.RemoveServiceCredential(token, "pods")
+	assert.Nil(t, err)
+	err = d.RemoveServiceCredential(token, "pods")
+	assert.NotNil(t, err)
+
+	infos, _, _ = d.ListServiceCredentials(token)
+	assert.Len(t, infos, 2)
+
+	_, err = d.SetServiceCredential("token2", "ci", ROLE_WRITER)
+	assert.NotNil(t, err)
+	_, found, err = d.ListServiceCredentials("token2")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
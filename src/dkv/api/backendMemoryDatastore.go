@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStruct keeps key values in memory only, for tests and throw away deployments.
+type MemoryStruct struct {
+	mutex sync.RWMutex
+	kvs   map[string]string
+}
+
+func init() {
+	RegisterDatastore("memory", NewMemoryStruct, nil)
+}
+
+func NewMemoryStruct(config DatastoreConfig) DatastoreConnector {
+	return &MemoryStruct{}
+}
+
+func (m *MemoryStruct) InitializeDatastoreClient() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.kvs == nil {
+		m.kvs = make(map[string]string)
+	}
+	return nil
+}
+
+func (m *MemoryStruct) CheckDatastoreHealth() error {
+	return nil
+}
+
+func (m *MemoryStruct) RequestPUT(prefix string, key string, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.kvs[prefix+key] = value
+	return nil
+}
+
+func (m *MemoryStruct) RequestGET(prefix string, key string) (string, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	value, found := m.kvs[prefix+key]
+	return value, found, nil
+}
+
+func (m *MemoryStruct) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := []KeyValue{}
+
+	for fullKey, value := range m.kvs {
+		if key, found := options.listedKey(prefix, fullKey); found {
+			res = append(res, KeyValue{Key: key, Value: value})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+
+	res, more := options.page(res)
+	return res, more, nil
+}
+
+func (m *MemoryStruct) RequestDELETE(prefix string, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.kvs, prefix+key)
+	return nil
+}
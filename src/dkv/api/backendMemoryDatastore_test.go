@@ -0,0 +1,52 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	m := newTestDatastore("memory")
+	err := m.InitializeDatastoreClient()
+	assert.Nil(t, err)
+
+	runDatastoreConformance(t, m)
+}
+
+func TestMemoryConcurrentRequests(t *testing.T) {
+	m := newTestDatastore("memory")
+	m.InitializeDatastoreClient()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "key" + strconv.Itoa(i)
+			m.RequestPUT("token1/", key, key)
+			m.RequestGET("token1/", key)
+			m.RequestLIST("", ListOptions{Recursive: true})
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, len(listAllKeys(t, m)))
+}
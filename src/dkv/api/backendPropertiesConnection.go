@@ -17,30 +17,46 @@
 package api
 
 import (
+	"bytes"
 	"errors"
 	"github.com/magiconair/properties"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
+// MANAGED_CONFIG_FILE holds the keys written directly with reflect, see UpdateManagedFile.
+const MANAGED_CONFIG_FILE = "managed.properties"
+
+var managedFileMutex sync.Mutex
+
 type KeyValuesInterface interface {
 	WriteKVsToDatastore(string, string, map[string]string) error
-	ConfigReader(string, string, string) (map[string]string, error)
-	ReadMultiplePropertiesRecursive(string, *map[string]string) error
-	ReadMultipleProperties(string, *map[string]string) error
+	ConfigReader(string, string, string, ConfigOptions) (map[string]string, error)
+	ReadConfigDirectory(string, bool, ConfigOptions, *map[string]string) error
+	ReadConfigFile(string, ConfigOptions, *map[string]string) error
 	ReadProperty(string, *map[string]string) error
+	TemplateVariables(string, string) (map[string]string, error)
+	UpdateManagedFile(string, string, map[string]string, []string) error
 }
 
 type KeyValuesStruct struct{}
 
-func (kvStruct *KeyValuesStruct) WriteKVsToDatastore(token string, subdomain string, kvs map[string]string) error {
-	var prefix = ""
+// datastorePrefix is the prefix the keys of token, or of its subdomain, are written under.
+func datastorePrefix(token string, subdomain string) string {
 	if subdomain != "" {
-		prefix += token + "/" + subdomain + "/"
-	} else {
-		prefix += token + "/"
+		return token + "/" + subdomain + "/"
 	}
+	return token + "/"
+}
+
+func (kvStruct *KeyValuesStruct) WriteKVsToDatastore(token string, subdomain string, kvs map[string]string) error {
+	prefix := datastorePrefix(token, subdomain)
 	for key, value := range kvs {
 		err := Datastore.RequestPUT(prefix, key, value)
 		if err != nil {
@@ -52,86 +68,274 @@ func (kvStruct *KeyValuesStruct) WriteKVsToDatastore(token string, subdomain str
 	return nil
 }
 
-func (kvStruct *KeyValuesStruct) ConfigReader(token string, subdomain string, filename string) (map[string]string, error) {
-	var filepath = MOUNTPATH
-	kvs := make(map[string]string)
+/*
+UpdateManagedFile sets kvs and removes deleted in the MANAGED_CONFIG_FILE of
+token, or of its subdomain, creating it if needed. Keys other files of the
+directory hold are not touched, so the file only overrides them.
+*/
+func (kvStruct *KeyValuesStruct) UpdateManagedFile(
+	token string, subdomain string, kvs map[string]string, deleted []string) error {
 
-	if filename != "" && subdomain != "" {
-		// Specific file in specific domain.
-		filepath += token + "/" + subdomain + "/" + filename
-		err := kvStruct.ReadProperty(filepath, &kvs)
-		if err != nil {
-			return kvs, err
-		}
-		return kvs, nil
+	path, err := MountPath(token, subdomain, MANAGED_CONFIG_FILE)
+	if err != nil {
+		return err
 	}
 
-	if filename != "" && subdomain == "" {
-		// Specific file in Token
-		filepath += token + "/" + filename
-		err := kvStruct.ReadProperty(filepath, &kvs)
+	managedFileMutex.Lock()
+	defer managedFileMutex.Unlock()
+
+	managed := make(map[string]string)
+	_, err = os.Stat(path)
+	if err == nil {
+		err = ReadPropertiesFile(path, ConfigOptions{}, &managed)
 		if err != nil {
-			return kvs, err
+			return ConfigErrors{toConfigFileError(MANAGED_CONFIG_FILE, err)}
 		}
-		return kvs, nil
 	}
 
-	if filename == "" && subdomain != "" {
-		// All files in specific domain
-		filepath += token + "/" + subdomain
-		err := kvStruct.ReadMultipleProperties(filepath, &kvs)
-		if err != nil {
-			return kvs, err
+	for key, value := range kvs {
+		managed[key] = value
+	}
+	for _, key := range deleted {
+		delete(managed, key)
+	}
+
+	keys := make([]string, 0, len(managed))
+	for key := range managed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	p := properties.NewProperties()
+	p.DisableExpansion = true
+	for _, key := range keys {
+		p.Set(key, managed[key])
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("# Written by the key write API. Edits are kept but comments are not.\n")
+	_, err = p.Write(&buffer, properties.UTF8)
+	if err != nil {
+		return err
+	}
+
+	err = WriteFileAtomic(path, buffer.Bytes(), 0660)
+	if err != nil {
+		return FilesystemError(err, "Directory of file "+MANAGED_CONFIG_FILE)
+	}
+	log.Println("[INFO] Wrote", len(kvs), "and removed", len(deleted), "keys in", path)
+	return nil
+}
+
+/*
+ManagedKeys returns the keys a load of token, subdomain and filename reads from
+MANAGED_CONFIG_FILE. They were written directly, so they are loaded as they
+are, without expanding references or rendering templates in them.
+*/
+func ManagedKeys(token string, subdomain string, filename string, options ConfigOptions) (map[string]string, error) {
+	managed := make(map[string]string)
+	if filename != "" && filename != MANAGED_CONFIG_FILE {
+		return managed, nil
+	}
+
+	path, err := MountPath(token, subdomain, MANAGED_CONFIG_FILE)
+	if err != nil {
+		return managed, err
+	}
+	_, err = os.Stat(path)
+	if err != nil {
+		return managed, nil
+	}
+	if filename == "" {
+		// Include and Exclude may leave the file out of the load.
+		files, err := ConfigFiles(filepath.Dir(path), false, options)
+		if err != nil || len(files) == 0 || files[len(files)-1] != MANAGED_CONFIG_FILE {
+			return managed, nil
 		}
 	}
 
-	filepath += token
-	err := kvStruct.ReadMultiplePropertiesRecursive(filepath, &kvs)
+	err = ReadPropertiesFile(path, ConfigOptions{}, &managed)
+	if err != nil {
+		return managed, ConfigErrors{toConfigFileError(MANAGED_CONFIG_FILE, err)}
+	}
+	return managed, nil
+}
+
+/*
+ConfigReader reads a single config file of a service, or all config files of
+the service or of one of its subdomains, see ReadConfigDirectory. Errors of
+config files are returned as ConfigErrors.
+*/
+func (kvStruct *KeyValuesStruct) ConfigReader(
+	token string, subdomain string, filename string, options ConfigOptions) (map[string]string, error) {
+
+	kvs := make(map[string]string)
+
+	path, err := MountPath(token, subdomain, filename)
 	if err != nil {
 		return kvs, err
 	}
-	return kvs, nil
+
+	if filename != "" {
+		err = kvStruct.ReadConfigFile(path, options, &kvs)
+		if err != nil {
+			return kvs, ConfigErrors{toConfigFileError(filename, err)}
+		}
+		return kvs, nil
+	}
+
+	// The sub directories of a service are its subdomains, loaded under their own prefix.
+	err = kvStruct.ReadConfigDirectory(path, false, options, &kvs)
+	return kvs, err
+}
+
+/*
+ConfigFiles returns the config files of dir, relative to dir, in the order they
+are read. The files of dir come first, by name, then, if subdomains is set, those
+of each of its sub directories, by name, one level deep. Reading them in this
+order lets the files of subdomains override those of their service.
+MANAGED_CONFIG_FILE is read after the other files of its directory, so keys
+written directly keep their value when the directory is loaded again.
+
+Patterns are matched as by path.Match. A pattern without a "/" is matched
+against the name of the file, otherwise against its path relative to dir. If
+options.Include is set only matching files are read, and files and directories
+matching options.Exclude are skipped.
+*/
+func ConfigFiles(dir string, subdomains bool, options ConfigOptions) ([]string, error) {
+	var files []string
+	err := walkConfigFiles(dir, "", subdomains, options, &files)
+	return files, err
 }
 
-func (kvStruct *KeyValuesStruct) ReadMultiplePropertiesRecursive(path string, kvs *map[string]string) error {
-	// Go inside each sub directory and run ReadMultipleProperties inside.
-	files, err := ioutil.ReadDir(path)
+func walkConfigFiles(dir string, rel string, subdomains bool, options ConfigOptions, files *[]string) error {
+	entries, err := ioutil.ReadDir(filepath.Join(dir, rel))
 	if err != nil {
 		return err
 	}
 
-	for _, f := range files {
-		fi, _ := os.Stat(path + "/" + f.Name())
-		if fi.Mode().IsDir() {
-			kvStruct.ReadMultipleProperties(path+"/"+f.Name(), kvs)
-		} else {
-			kvStruct.ReadProperty(path+"/"+f.Name(), kvs)
+	var directories []string
+	managed := false
+	for _, entry := range entries {
+		name := path.Join(rel, entry.Name())
+		if matchAnyConfigPattern(options.Exclude, name) {
+			continue
+		}
+		if entry.IsDir() {
+			if subdomains {
+				directories = append(directories, name)
+			}
+			continue
+		}
+		if entry.Name() == TEMPLATE_VARIABLES_FILE {
+			continue
+		}
+		if len(options.Include) > 0 && matchAnyConfigPattern(options.Include, name) == false {
+			continue
+		}
+		if entry.Name() == MANAGED_CONFIG_FILE {
+			managed = true
+			continue
+		}
+		*files = append(*files, name)
+	}
+	if managed {
+		*files = append(*files, path.Join(rel, MANAGED_CONFIG_FILE))
+	}
+
+	for _, name := range directories {
+		err = walkConfigFiles(dir, name, false, options, files)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (kvStruct *KeyValuesStruct) ReadMultipleProperties(path string, kvs *map[string]string) error {
-	files, err := ioutil.ReadDir(path)
+func matchAnyConfigPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern, "/") == false {
+			target = path.Base(name)
+		}
+		matched, _ := path.Match(pattern, target)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ReadConfigDirectory reads the files ConfigFiles returns for dir, in that order,
+so that a key in a later file overrides the same key in earlier ones. It carries
+on past files that fail and returns ConfigErrors naming all of them, relative to
+dir, so that one bad upload does not hide the others.
+*/
+func (kvStruct *KeyValuesStruct) ReadConfigDirectory(
+	dir string, subdomains bool, options ConfigOptions, kvs *map[string]string) error {
+
+	files, err := ConfigFiles(dir, subdomains, options)
 	if err != nil {
-		return err
+		return FilesystemError(err, "Config directory")
 	}
 
-	for _, f := range files {
-		kvStruct.ReadProperty(path+f.Name(), kvs)
+	var errs ConfigErrors
+	for _, name := range files {
+		// Symlinks in the mount may not lead out of it.
+		_, err = ConfinePath(filepath.Join(dir, name))
+		if err == nil {
+			err = kvStruct.ReadConfigFile(filepath.Join(dir, name), options, kvs)
+		}
+		if err != nil {
+			fileErr := toConfigFileError(name, err)
+			fileErr.File = name
+			errs = append(errs, fileErr)
+		}
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
+// ReadConfigFile reads a file with the parser for its format, see DetectConfigFormat.
+func (kvStruct *KeyValuesStruct) ReadConfigFile(path string, options ConfigOptions, kvs *map[string]string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return errors.New("File does not exists.")
+	}
+	if fi.IsDir() {
+		return newConfigFileError(path, 0, "is a directory.")
+	}
+	format := DetectConfigFormat(path, options)
+	if format == CONFIG_FORMAT_PROPERTIES {
+		return kvStruct.ReadProperty(path, kvs)
+	}
+	return configParsers[format](path, options, kvs)
+}
+
 func (kvStruct *KeyValuesStruct) ReadProperty(path string, kvs *map[string]string) error {
+	return ReadPropertiesFile(path, ConfigOptions{}, kvs)
+}
+
+func ReadPropertiesFile(path string, options ConfigOptions, kvs *map[string]string) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return errors.New("File does not exists.")
 	}
-	p := properties.MustLoadFile(path, properties.UTF8)
+	// ${key} references are resolved across files by ExpandReferences, so the
+	// loader must neither expand nor check them.
+	loader := properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+	p, err := loader.LoadFile(path)
+	if err != nil {
+		line, msg := parseErrorLine(propertiesErrorPattern, err.Error())
+		return newConfigFileError(path, line, msg)
+	}
 	for _, key := range p.Keys() {
-		(*kvs)[key] = p.MustGet(key)
+		value, _ := p.Get(key)
+		(*kvs)[key] = value
 	}
 	return nil
 }
@@ -0,0 +1,355 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// Interface to have token to service registry signature methods.
+type ServiceRegistry interface {
+	InitialiseRegistry() error
+	AddService(string, string) error
+	DeleteService(string) error
+	FindToken(string) (bool, error)
+	FindServiceName(string) (bool, error)
+	GetServiceByToken(string) (string, bool, error)
+	GetService(string) (Token_service_map, bool, error)
+	ListServices() ([]Token_service_map, error)
+	SetCredential(string, Credential) error
+	DeleteCredential(string, string) error
+	GetCredentials(string) ([]Credential, bool, error)
+}
+
+const (
+	// Reserved datastore namespace. Tokens are UUIDs or "default" so this can
+	// never clash with the key values written under a token.
+	REGISTRY_PREFIX          = "dkv-registry/"
+	REGISTRY_SERVICES_PREFIX = REGISTRY_PREFIX + "services/"
+	REGISTRY_NAMES_PREFIX    = REGISTRY_PREFIX + "names/"
+)
+
+func NewRegistry(registryType string) (ServiceRegistry, error) {
+	if registryType == "" || registryType == "datastore" {
+		return &DatastoreRegistryStruct{}, nil
+	}
+	if registryType == "file" {
+		return &JSONRegistryStruct{path: JSONPATH}, nil
+	}
+	return nil, errors.New("Unrecognised Registry. Supports only datastore or file")
+}
+
+/*
+DatastoreRegistryStruct keeps the registry in the configured Datastore so that
+all replicas behind a load balancer share it. Each service is stored as a
+Token_service_map record under REGISTRY_SERVICES_PREFIX keyed by token, with an
+index from service name to token under REGISTRY_NAMES_PREFIX.
+*/
+type DatastoreRegistryStruct struct{}
+
+func (d *DatastoreRegistryStruct) InitialiseRegistry() error {
+	found, err := d.FindToken("default")
+	if err != nil {
+		return err
+	}
+	if found == false {
+		log.Println("[INFO] Default service not found in registry. Creating.")
+		err = d.AddService("default", "default")
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.importJSON(JSONPATH)
+}
+
+/*
+importJSON copies the services of a token_service_map.json left over from
+a file based registry into the datastore, so that upgrading does not lose
+registrations. Services already in the datastore are left alone. The file is
+renamed afterwards so that services deleted later are not imported again.
+*/
+func (d *DatastoreRegistryStruct) importJSON(path string) error {
+	jsonExists, _ := JsonChecker(path)
+	if jsonExists == false {
+		return nil
+	}
+
+	serviceList, err := JsonReader(path)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range serviceList {
+		if service.Token == "" {
+			continue
+		}
+		found, err := d.FindToken(service.Token)
+		if err != nil {
+			return err
+		}
+		if found {
+			continue
+		}
+		log.Println("[INFO] Importing service", service.Service, "from", path)
+		if service.CreatedAt == "" {
+			service.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+		}
+		err = d.addRecord(service)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(path, path+".imported")
+}
+
+/*
+AddService writes the record before the name index so that a crash in between
+leaves a service reachable by token. The datastore has no compare and swap, so
+two replicas registering the same name at the same moment can both succeed.
+*/
+func (d *DatastoreRegistryStruct) AddService(token string, service string) error {
+	return d.addRecord(Token_service_map{
+		Token:     token,
+		Service:   service,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (d *DatastoreRegistryStruct) addRecord(tsm Token_service_map) error {
+	err := d.putRecord(tsm)
+	if err != nil {
+		return err
+	}
+
+	err = Datastore.RequestPUT(REGISTRY_NAMES_PREFIX, tsm.Service, tsm.Token)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *DatastoreRegistryStruct) DeleteService(token string) error {
+	tsm, found, err := d.getRecord(token)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		return NotFoundError("Service not found. Check if Token is correct or service is registered.")
+	}
+
+	err = Datastore.RequestDELETE(REGISTRY_NAMES_PREFIX, tsm.Service)
+	if err != nil {
+		return err
+	}
+
+	err = Datastore.RequestDELETE(REGISTRY_SERVICES_PREFIX, token)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *DatastoreRegistryStruct) FindToken(token string) (bool, error) {
+	_, found, err := d.getRecord(token)
+	return found, err
+}
+
+func (d *DatastoreRegistryStruct) FindServiceName(serviceName string) (bool, error) {
+	_, found, err := Datastore.RequestGET(REGISTRY_NAMES_PREFIX, serviceName)
+	return found, err
+}
+
+func (d *DatastoreRegistryStruct) GetServiceByToken(token string) (string, bool, error) {
+	tsm, found, err := d.getRecord(token)
+	if err != nil || found == false {
+		return "", false, err
+	}
+	return tsm.Service, true, nil
+}
+
+func (d *DatastoreRegistryStruct) GetService(token string) (Token_service_map, bool, error) {
+	return d.getRecord(token)
+}
+
+func (d *DatastoreRegistryStruct) SetCredential(token string, credential Credential) error {
+	tsm, found, err := d.getRecord(token)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		return NotFoundError("Service not found. Check if Token is correct or service is registered.")
+	}
+
+	tsm.Credentials = setCredential(tsm.Credentials, credential)
+	return d.putRecord(tsm)
+}
+
+func (d *DatastoreRegistryStruct) DeleteCredential(token string, name string) error {
+	tsm, found, err := d.getRecord(token)
+	if err != nil {
+		return err
+	}
+	if found == false {
+		return NotFoundError("Service not found. Check if Token is correct or service is registered.")
+	}
+
+	tsm.Credentials, found = removeCredential(tsm.Credentials, name)
+	if found == false {
+		return NotFoundError("Credential " + name + " not found.")
+	}
+	return d.putRecord(tsm)
+}
+
+func (d *DatastoreRegistryStruct) GetCredentials(token string) ([]Credential, bool, error) {
+	tsm, found, err := d.getRecord(token)
+	if err != nil || found == false {
+		return nil, false, err
+	}
+	return tsm.Credentials, true, nil
+}
+
+func (d *DatastoreRegistryStruct) ListServices() ([]Token_service_map, error) {
+	var tsm_list []Token_service_map
+
+	records, _, err := Datastore.RequestLIST(REGISTRY_SERVICES_PREFIX, ListOptions{})
+	if err != nil {
+		return tsm_list, err
+	}
+
+	for _, record := range records {
+		var tsm Token_service_map
+		err = json.Unmarshal([]byte(record.Value), &tsm)
+		if err != nil {
+			return tsm_list, InternalError(errors.New("Registry record for token " + record.Key + " is corrupt."))
+		}
+		tsm_list = append(tsm_list, tsm)
+	}
+	return tsm_list, nil
+}
+
+// putRecord writes the record of a service without touching the name index.
+func (d *DatastoreRegistryStruct) putRecord(tsm Token_service_map) error {
+	raw, err := json.Marshal(tsm)
+	if err != nil {
+		return err
+	}
+	return Datastore.RequestPUT(REGISTRY_SERVICES_PREFIX, tsm.Token, string(raw))
+}
+
+func (d *DatastoreRegistryStruct) getRecord(token string) (Token_service_map, bool, error) {
+	var tsm Token_service_map
+
+	raw, found, err := Datastore.RequestGET(REGISTRY_SERVICES_PREFIX, token)
+	if err != nil || found == false {
+		return tsm, false, err
+	}
+
+	err = json.Unmarshal([]byte(raw), &tsm)
+	if err != nil {
+		return tsm, false, InternalError(errors.New("Registry record for token " + token + " is corrupt."))
+	}
+	return tsm, true, nil
+}
+
+// JSONRegistryStruct keeps the registry in a local token_service_map.json file.
+type JSONRegistryStruct struct {
+	path string
+}
+
+func (j *JSONRegistryStruct) InitialiseRegistry() error {
+	jsonExists, _ := JsonChecker(j.path)
+	if jsonExists == false {
+		log.Println("[INFO] token_service_map.json not found. Creating.")
+		err := JsonCreate(j.path)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	corrupt, err := CheckJSONCorrupt(j.path)
+	if err != nil {
+		return err
+	}
+	if corrupt {
+		log.Println("[ERROR] token_service_map.json is corrupt. Moving it to",
+			j.path+".corrupt", "and creating a new one. Services registered in it must be registered again.")
+		err = JsonRepair(j.path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *JSONRegistryStruct) AddService(token string, service string) error {
+	return WriteJSON(j.path, token, service)
+}
+
+func (j *JSONRegistryStruct) DeleteService(token string) error {
+	return DeleteInJSON(j.path, token)
+}
+
+func (j *JSONRegistryStruct) FindToken(token string) (bool, error) {
+	return FindTokenInJSON(j.path, token)
+}
+
+func (j *JSONRegistryStruct) FindServiceName(serviceName string) (bool, error) {
+	return FindServiceInJSON(j.path, serviceName)
+}
+
+func (j *JSONRegistryStruct) GetServiceByToken(token string) (string, bool, error) {
+	return GetServicebyToken(j.path, token)
+}
+
+func (j *JSONRegistryStruct) GetService(token string) (Token_service_map, bool, error) {
+	return GetServiceRecordByToken(j.path, token)
+}
+
+func (j *JSONRegistryStruct) SetCredential(token string, credential Credential) error {
+	return SetCredentialInJSON(j.path, token, credential)
+}
+
+func (j *JSONRegistryStruct) DeleteCredential(token string, name string) error {
+	return DeleteCredentialInJSON(j.path, token, name)
+}
+
+func (j *JSONRegistryStruct) GetCredentials(token string) ([]Credential, bool, error) {
+	return GetCredentialsInJSON(j.path, token)
+}
+
+func (j *JSONRegistryStruct) ListServices() ([]Token_service_map, error) {
+	var tsm_list []Token_service_map
+
+	serviceList, err := JsonReader(j.path)
+	if err != nil {
+		return tsm_list, err
+	}
+
+	// Skip the empty placeholder written by DeleteInJSON.
+	for _, service := range serviceList {
+		if service.Token != "" {
+			tsm_list = append(tsm_list, service)
+		}
+	}
+	return tsm_list, nil
+}
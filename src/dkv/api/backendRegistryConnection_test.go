@@ -0,0 +1,274 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Swaps in an empty memory Datastore for the duration of a test.
+func setupMemoryDatastore() func() {
+	oldDatastore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	return func() { Datastore = oldDatastore }
+}
+
+func TestNewRegistry(t *testing.T) {
+	registry, err := NewRegistry("")
+	assert.Nil(t, err)
+	assert.IsType(t, &DatastoreRegistryStruct{}, registry)
+
+	registry, err = NewRegistry("file")
+	assert.Nil(t, err)
+	assert.IsType(t, &JSONRegistryStruct{}, registry)
+
+	_, err = NewRegistry("test")
+	assert.NotNil(t, err)
+}
+
+func TestDatastoreRegistry(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	r := &DatastoreRegistryStruct{}
+
+	err := r.AddService("token1", "service1")
+	assert.Nil(t, err)
+
+	found, err := r.FindToken("token1")
+	assert.Nil(t, err)
+	assert.True(t, found, "Token should be found in registry.")
+
+	found, err = r.FindServiceName("service1")
+	assert.Nil(t, err)
+	assert.True(t, found, "Service should be found in registry.")
+
+	service, found, err := r.GetServiceByToken("token1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "service1", service)
+
+	tsm, found, err := r.GetService("token1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "service1", tsm.Service)
+	assert.NotEmpty(t, tsm.CreatedAt)
+
+	err = r.DeleteService("token1")
+	assert.Nil(t, err)
+
+	found, _ = r.FindToken("token1")
+	assert.False(t, found, "Token should not be found in registry.")
+	found, _ = r.FindServiceName("service1")
+	assert.False(t, found, "Service should not be found in registry.")
+}
+
+func TestDatastoreRegistry_not_found(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	r := &DatastoreRegistryStruct{}
+
+	service, found, err := r.GetServiceByToken("token1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Equal(t, "", service)
+
+	err = r.DeleteService("token1")
+	assert.NotNil(t, err)
+}
+
+func TestDatastoreRegistry_shared(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	// Two replicas only share the Datastore.
+	r1 := &DatastoreRegistryStruct{}
+	r2 := &DatastoreRegistryStruct{}
+
+	r1.AddService("token1", "service1")
+
+	service, found, _ := r2.GetServiceByToken("token1")
+	assert.True(t, found)
+	assert.Equal(t, "service1", service)
+}
+
+func TestDatastoreRegistry_err(t *testing.T) {
+	oldDatastore := Datastore
+	Datastore = &FakeConsulErr{}
+	defer func() { Datastore = oldDatastore }()
+
+	r := &DatastoreRegistryStruct{}
+
+	_, err := r.FindToken("token1")
+	assert.NotNil(t, err)
+
+	err = r.InitialiseRegistry()
+	assert.NotNil(t, err)
+}
+
+func TestDatastoreRegistryInitialise(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	oldJsonChecker := JsonChecker
+	defer func() { JsonChecker = oldJsonChecker }()
+	JsonChecker = func(path string) (bool, error) {
+		return false, nil
+	}
+
+	r := &DatastoreRegistryStruct{}
+	err := r.InitialiseRegistry()
+	assert.Nil(t, err)
+
+	service, found, _ := r.GetServiceByToken("default")
+	assert.True(t, found, "Default service should be created.")
+	assert.Equal(t, "default", service)
+}
+
+func TestDatastoreRegistryImportJSON(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	dir, _ := ioutil.TempDir("", "dkv-registry")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token_service_map.json")
+	ioutil.WriteFile(path, []byte(`[{"token":"default","service":"default"},{"token":"token1","service":"service1"},{"token":"","service":""}]`), 0644)
+
+	r := &DatastoreRegistryStruct{}
+	err := r.importJSON(path)
+	assert.Nil(t, err)
+
+	service, found, _ := r.GetServiceByToken("token1")
+	assert.True(t, found, "Service should be imported.")
+	assert.Equal(t, "service1", service)
+
+	found, _ = r.FindToken("")
+	assert.False(t, found, "Empty placeholder should not be imported.")
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "JSON file should be renamed after import.")
+	_, err = os.Stat(path + ".imported")
+	assert.Nil(t, err)
+}
+
+func TestDatastoreRegistryListServices(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	r := &DatastoreRegistryStruct{}
+	r.AddService("token1", "service1")
+	r.AddService("token2", "service2")
+	// Key values of a service must not show up as services.
+	Datastore.RequestPUT("token1/", "key1", "value1")
+
+	services, err := r.ListServices()
+	assert.Nil(t, err)
+	assert.Len(t, services, 2)
+	assert.Equal(t, "token1", services[0].Token)
+	assert.Equal(t, "service1", services[0].Service)
+	assert.NotEmpty(t, services[0].CreatedAt)
+	assert.Equal(t, "token2", services[1].Token)
+}
+
+func TestJSONRegistryListServices(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "dkv-registry")
+	defer os.RemoveAll(dir)
+
+	oldIoutilRead := IoutilRead
+	oldIoutilWrite := IoutilWrite
+	oldReadJson := JsonReader
+	defer func() {
+		IoutilRead = oldIoutilRead
+		IoutilWrite = oldIoutilWrite
+		JsonReader = oldReadJson
+	}()
+	IoutilRead = ioutil.ReadFile
+	IoutilWrite = WriteFileAtomic
+	JsonReader = ReadJSON
+
+	r := &JSONRegistryStruct{path: filepath.Join(dir, "token_service_map.json")}
+	CreateJSON(r.path)
+	r.AddService("token1", "service1")
+	r.DeleteService("token1")
+	r.AddService("token2", "service2")
+
+	services, err := r.ListServices()
+	assert.Nil(t, err)
+	assert.Len(t, services, 2)
+	assert.Equal(t, "default", services[0].Token)
+	assert.Equal(t, "token2", services[1].Token)
+	assert.NotEmpty(t, services[1].CreatedAt)
+
+	tsm, found, err := r.GetService("token2")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, services[1], tsm)
+	_, found, _ = r.GetService("token1")
+	assert.False(t, found)
+}
+
+func TestDatastoreRegistryCredentials(t *testing.T) {
+	cleanup := setupMemoryDatastore()
+	defer cleanup()
+
+	r := &DatastoreRegistryStruct{}
+	r.AddService("token1", "service1")
+
+	credentials, found, err := r.GetCredentials("token1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Empty(t, credentials, "Services start without credentials.")
+
+	err = r.SetCredential("token1", Credential{Name: "ci", Role: ROLE_WRITER, SecretHash: "hash1"})
+	assert.Nil(t, err)
+	err = r.SetCredential("token1", Credential{Name: "pods", Role: ROLE_READ_ONLY, SecretHash: "hash2"})
+	assert.Nil(t, err)
+	err = r.SetCredential("token1", Credential{Name: "ci", Role: ROLE_ADMIN, SecretHash: "hash3"})
+	assert.Nil(t, err)
+
+	credentials, _, _ = r.GetCredentials("token1")
+	assert.Equal(t, []Credential{
+		{Name: "ci", Role: ROLE_ADMIN, SecretHash: "hash3"},
+		{Name: "pods", Role: ROLE_READ_ONLY, SecretHash: "hash2"},
+	}, credentials)
+
+	err = r.DeleteCredential("token1", "ci")
+	assert.Nil(t, err)
+	err = r.DeleteCredential("token1", "ci")
+	assert.NotNil(t, err)
+	credentials, _, _ = r.GetCredentials("token1")
+	assert.Len(t, credentials, 1)
+
+	// The rest of the record is untouched.
+	service, found, _ := r.GetServiceByToken("token1")
+	assert.True(t, found)
+	assert.Equal(t, "service1", service)
+
+	err = r.SetCredential("token2", Credential{Name: "ci", Role: ROLE_WRITER, SecretHash: "hash1"})
+	assert.NotNil(t, err)
+	err = r.DeleteCredential("token2", "ci")
+	assert.NotNil(t, err)
+	_, found, err = r.GetCredentials("token2")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
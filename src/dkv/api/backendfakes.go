@@ -39,18 +39,18 @@ func (f *FakeConsul) CheckDatastoreHealth() error {
 	return nil
 }
 
-func (f *FakeConsul) RequestGETS() ([]string, error) {
-	return []string{"key1", "key2"}, nil
-}
-
-func (f *FakeConsul) RequestGET(key string, token string) (string, error) {
-	return key, nil
+func (f *FakeConsul) RequestGET(key string, token string) (string, bool, error) {
+	return key, true, nil
 }
 
 func (f *FakeConsul) RequestPUT(key string, value string, token string) error {
 	return nil
 }
 
+func (f *FakeConsul) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
+	return []KeyValue{{Key: "key1", Value: "value1"}, {Key: "key2", Value: "value2"}}, false, nil
+}
+
 func (f *FakeConsul) RequestDELETE(key string, token string) error {
 	return nil
 }
@@ -68,12 +68,12 @@ func (f *FakeConsulErr) CheckDatastoreHealth() error {
 	return errors.New("Internal Server Error")
 }
 
-func (f *FakeConsulErr) RequestGETS() ([]string, error) {
-	return []string{"", ""}, errors.New("Internal Server Error")
+func (f *FakeConsulErr) RequestGET(key string, token string) (string, bool, error) {
+	return "", false, errors.New("Internal Server Error")
 }
 
-func (f *FakeConsulErr) RequestGET(key string, token string) (string, error) {
-	return "", errors.New("Internal Server Error")
+func (f *FakeConsulErr) RequestLIST(prefix string, options ListOptions) ([]KeyValue, bool, error) {
+	return nil, false, errors.New("Internal Server Error")
 }
 
 func (f *FakeConsulErr) RequestDELETE(key string, token string) error {
@@ -89,7 +89,8 @@ type FakeKeyValues struct {
 	KeyValuesStruct
 }
 
-func (f *FakeKeyValues) ConfigReader(token string, subdomain string, filename string) (map[string]string, error) {
+func (f *FakeKeyValues) ConfigReader(
+	token string, subdomain string, filename string, options ConfigOptions) (map[string]string, error) {
 	kvs := make(map[string]string)
 	return kvs, nil
 }
@@ -98,12 +99,23 @@ func (f *FakeKeyValues) WriteKVsToDatastore(token string, subdomain string, kvs
 	return nil
 }
 
+func (f *FakeKeyValues) TemplateVariables(token string, subdomain string) (map[string]string, error) {
+	variables := make(map[string]string)
+	return variables, nil
+}
+
+func (f *FakeKeyValues) UpdateManagedFile(
+	token string, subdomain string, kvs map[string]string, deleted []string) error {
+	return nil
+}
+
 // Error
 type FakeKeyValuesErr struct {
 	KeyValuesStruct
 }
 
-func (f *FakeKeyValuesErr) ConfigReader(token string, subdomain string, filename string) (map[string]string, error) {
+func (f *FakeKeyValuesErr) ConfigReader(
+	token string, subdomain string, filename string, options ConfigOptions) (map[string]string, error) {
 	kvs := make(map[string]string)
 	return kvs, errors.New("Internal Server Error")
 }
@@ -112,13 +124,38 @@ func (f *FakeKeyValuesErr) WriteKVsToDatastore(token string, subdomain string, k
 	return errors.New("Internal Server Error")
 }
 
+func (f *FakeKeyValuesErr) TemplateVariables(token string, subdomain string) (map[string]string, error) {
+	variables := make(map[string]string)
+	return variables, errors.New("Internal Server Error")
+}
+
+func (f *FakeKeyValuesErr) UpdateManagedFile(
+	token string, subdomain string, kvs map[string]string, deleted []string) error {
+	return errors.New("Internal Server Error")
+}
+
 // Correct
 type FakeDirectory struct {
 	DirectoryStruct
 }
 
-func (f *FakeDirectory) CreateService(CreateRegisterServiceBody) (string, error) {
-	return "", nil
+func (f *FakeDirectory) CreateService(CreateRegisterServiceBody) (string, string, error) {
+	return "", "", nil
+}
+
+func (f *FakeDirectory) SetServiceCredential(token string, name string, role string) (string, error) {
+	return "secret1", nil
+}
+
+func (f *FakeDirectory) RemoveServiceCredential(token string, name string) error {
+	return nil
+}
+
+func (f *FakeDirectory) ListServiceCredentials(token string) ([]CredentialInfo, bool, error) {
+	if token != "token1" {
+		return nil, false, nil
+	}
+	return []CredentialInfo{{Name: OWNER_CREDENTIAL, Role: ROLE_ADMIN}}, true, nil
 }
 
 func (f *FakeDirectory) RemoveService(token string) error {
@@ -137,6 +174,31 @@ func (f *FakeDirectory) FindService(token string) (string, bool, error) {
 	return "service1", true, nil
 }
 
+func (f *FakeDirectory) ListServices() ([]ServiceInfo, error) {
+	return []ServiceInfo{
+		{Token: "token1", Service: "service1", CreatedAt: "2018-01-01T00:00:00Z", Subdomains: 1},
+	}, nil
+}
+
+func (f *FakeDirectory) GetServiceInfo(token string) (ServiceInfo, bool, error) {
+	services, _ := f.ListServices()
+	for _, s := range services {
+		if s.Token == token {
+			return s, true, nil
+		}
+	}
+	return ServiceInfo{}, false, nil
+}
+
+func (f *FakeDirectory) ListServiceSubdomains(token string) ([]SubdomainInfo, bool, error) {
+	if token != "token1" {
+		return nil, false, nil
+	}
+	return []SubdomainInfo{
+		{Subdomain: "subdomain1", Files: []string{"config.properties"}},
+	}, true, nil
+}
+
 func (f *FakeDirectory) FetchFile(
 	w http.ResponseWriter, r *http.Request, token string, subdomain string, filename string) {
 }
@@ -150,10 +212,22 @@ type FakeDirectoryErr struct {
 	DirectoryStruct
 }
 
-func (f *FakeDirectoryErr) CreateService(CreateRegisterServiceBody) (string, error) {
+func (f *FakeDirectoryErr) CreateService(CreateRegisterServiceBody) (string, string, error) {
+	return "", "", errors.New("Internal Server Error.")
+}
+
+func (f *FakeDirectoryErr) SetServiceCredential(token string, name string, role string) (string, error) {
 	return "", errors.New("Internal Server Error.")
 }
 
+func (f *FakeDirectoryErr) RemoveServiceCredential(token string, name string) error {
+	return errors.New("Internal Server Error.")
+}
+
+func (f *FakeDirectoryErr) ListServiceCredentials(token string) ([]CredentialInfo, bool, error) {
+	return nil, false, errors.New("Internal Server Error.")
+}
+
 func (f *FakeDirectoryErr) RemoveService(token string) error {
 	return errors.New("Internal Server Error.")
 }
@@ -170,6 +244,18 @@ func (f *FakeDirectoryErr) FindService(token string) (string, bool, error) {
 	return "", false, errors.New("Internal Server Error.")
 }
 
+func (f *FakeDirectoryErr) ListServices() ([]ServiceInfo, error) {
+	return nil, errors.New("Internal Server Error.")
+}
+
+func (f *FakeDirectoryErr) GetServiceInfo(token string) (ServiceInfo, bool, error) {
+	return ServiceInfo{}, false, errors.New("Internal Server Error.")
+}
+
+func (f *FakeDirectoryErr) ListServiceSubdomains(token string) ([]SubdomainInfo, bool, error) {
+	return nil, false, errors.New("Internal Server Error.")
+}
+
 func (f *FakeDirectoryErr) FetchFile(
 	w http.ResponseWriter, r *http.Request, token string, subdomain string, filename string) {
 
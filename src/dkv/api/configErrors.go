@@ -0,0 +1,83 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+ConfigFileError is a config file that could not be read. File is relative to
+the directory being loaded so that the mount path is never shown. Line is 0
+when the parser does not say where it failed.
+*/
+type ConfigFileError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ConfigFileError) Error() string {
+	if e.Line > 0 {
+		return "Unable to parse " + e.File + " at line " + strconv.Itoa(e.Line) + ": " + e.Message
+	}
+	return "Unable to parse " + e.File + ": " + e.Message
+}
+
+// ConfigErrors collects the errors of every file that failed while loading a directory.
+type ConfigErrors []*ConfigFileError
+
+func (e ConfigErrors) Error() string {
+	var msgs []string
+	for _, fileErr := range e {
+		msgs = append(msgs, fileErr.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func newConfigFileError(path string, line int, msg string) *ConfigFileError {
+	return &ConfigFileError{File: filepath.Base(path), Line: line, Message: msg}
+}
+
+// toConfigFileError wraps any error reading path, dropping the full path os errors carry.
+func toConfigFileError(path string, err error) *ConfigFileError {
+	switch e := err.(type) {
+	case *ConfigFileError:
+		return e
+	case *os.PathError:
+		return newConfigFileError(path, 0, e.Err.Error())
+	}
+	return newConfigFileError(path, 0, err.Error())
+}
+
+/*
+parseErrorLine splits a parser error message into line and message using
+pattern, which must capture the line number and then the message. Messages
+that do not match are returned whole with line 0.
+*/
+func parseErrorLine(pattern *regexp.Regexp, msg string) (int, string) {
+	match := pattern.FindStringSubmatch(msg)
+	if match == nil {
+		return 0, msg
+	}
+	line, _ := strconv.Atoi(match[1])
+	return line, match[2]
+}
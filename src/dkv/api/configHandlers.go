@@ -18,11 +18,12 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
 	"github.com/gorilla/mux"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 type UploadConfigBody struct {
@@ -35,26 +36,70 @@ type LoadConfigBody struct {
 	Token     string `json:"token"`
 	Filename  string `json:"filename"`
 	Subdomain string `json:"subdomain"`
+	// Optional. Overrides the format detected from the file extension.
+	Format string `json:"format"`
+	// Optional. Joins nested keys and INI sections, . or /.
+	Separator string `json:"separator"`
+	// Optional. Globs selecting the files read from a directory, see ConfigFiles.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Optional. Template variables, taking precedence over the variables files.
+	Variables map[string]string `json:"variables"`
+	// Optional. Loads placeholders without a variable as they are instead of failing.
+	AllowUnresolved bool `json:"allow_unresolved"`
+}
+
+// ResponseConfigErrorsStruct lists the config files that could not be parsed.
+type ResponseConfigErrorsStruct struct {
+	Response string             `json:"response"`
+	Errors   []*ConfigFileError `json:"errors"`
+}
+
+// ResponseUnresolvedVariablesStruct lists the template variables no value was given for.
+type ResponseUnresolvedVariablesStruct struct {
+	Response   string   `json:"response"`
+	Unresolved []string `json:"unresolved"`
+}
+
+// ResponseReferenceErrorStruct lists the ${key} references that could not be expanded.
+type ResponseReferenceErrorStruct struct {
+	Response   string   `json:"response"`
+	Unresolved []string `json:"unresolved,omitempty"`
+	Cycles     []string `json:"cycles,omitempty"`
+	TooLarge   []string `json:"tooLarge,omitempty"`
+}
+
+func configOptions(body LoadConfigBody) ConfigOptions {
+	return ConfigOptions{
+		Format:    body.Format,
+		Separator: body.Separator,
+		Include:   body.Include,
+		Exclude:   body.Exclude,
+	}
 }
 
 func ValidateLoadConfigBody(body LoadConfigBody) error {
 	if body.Token == "" {
-		return errors.New("Token not set. Please set Token in POST.")
+		return InvalidError("Token not set. Please set Token in POST.")
 	}
-	return nil
+	err := ValidatePathNames(body.Token, body.Subdomain, body.Filename)
+	if err != nil {
+		return err
+	}
+	return ValidateConfigOptions(configOptions(body))
 }
 
 func HandleConfigUpload(w http.ResponseWriter, r *http.Request) {
 	r.ParseMultipartForm(100000) // 2k bytes?
 	file, handler, err := r.FormFile("configFile")
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, "Error in uploaded file.")
+		GenerateErrorResponse(w, r, InvalidError("Error in uploaded file."))
 		return
 	}
 	defer file.Close()
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 		return
 	}
 
@@ -62,27 +107,31 @@ func HandleConfigUpload(w http.ResponseWriter, r *http.Request) {
 	subdomain := r.Form.Get("subdomain")
 
 	if token == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "Token not present in Form data.")
+		GenerateErrorResponse(w, r, InvalidError("Token not present in Form data."))
 		return
 	}
 
-	var filename = ""
-	if subdomain != "" {
-		filename += token + "/" + subdomain + "/" + handler.Filename
-	} else {
-		filename += token + "/" + handler.Filename
+	err = ValidatePathNames(token, subdomain, handler.Filename)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
 	}
 
-	f, err := Directory.CreateFile(MOUNTPATH + filename)
+	if !Authorise(w, r, token, ROLE_WRITER) {
+		return
+	}
+
+	f, err := Directory.CreateFile(token, subdomain, handler.Filename)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 		return
 	}
 	defer f.Close()
 	io.Copy(f, file)
 
-	GenerateResponse(w, r, http.StatusOK, "Configuration uploaded to Token: "+token)
+	GenerateResult(w, r, ResponseStringStruct{Response: "Configuration uploaded to Token: " + token},
+		http.StatusCreated, ConfigFileResult{Token: token, Subdomain: subdomain, Filename: handler.Filename})
 }
 
 func HandleConfigLoad(w http.ResponseWriter, r *http.Request) {
@@ -93,44 +142,209 @@ func HandleConfigLoad(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&body)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusBadRequest, "Empty body.")
+		GenerateErrorResponse(w, r, InvalidError("Empty body."))
 		return
 	}
 
 	err = ValidateLoadConfigBody(body)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusBadRequest, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, body.Token, ROLE_WRITER) {
+		return
+	}
+
+	options := configOptions(body)
+	kvs_map, err := KeyValues.ConfigReader(body.Token, body.Subdomain, body.Filename, options)
+
+	if err != nil {
+		generateConfigReadError(w, r, err)
+		return
+	}
+
+	err = checkSubdomainKeys(body.Token, body.Subdomain, kvs_map)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	managed, err := ManagedKeys(body.Token, body.Subdomain, body.Filename, options)
+
+	if err != nil {
+		generateConfigReadError(w, r, err)
+		return
+	}
+
+	for key := range managed {
+		delete(kvs_map, key)
+	}
+	err = ExpandServiceReferences(body.Token, kvs_map, managed, options)
+
+	if err != nil {
+		generateConfigReadError(w, r, err)
 		return
 	}
 
-	kvs_map, err := KeyValues.ConfigReader(body.Token, body.Subdomain, body.Filename)
+	variables, err := KeyValues.TemplateVariables(body.Token, body.Subdomain)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		generateConfigReadError(w, r, err)
 		return
 	}
 
+	for name, value := range body.Variables {
+		variables[name] = value
+	}
+	unresolved := RenderTemplates(kvs_map, variables)
+
+	if len(unresolved) > 0 && body.AllowUnresolved == false {
+		generateConfigReadError(w, r, &UnresolvedVariablesError{Variables: unresolved})
+		return
+	}
+
+	for key, value := range managed {
+		kvs_map[key] = value
+	}
+
 	err = KeyValues.WriteKVsToDatastore(body.Token, body.Subdomain, kvs_map)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, DatastoreError(err))
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Configuration read and Key Values loaded to Consul.")
+		GenerateResult(w, r,
+			ResponseStringStruct{Response: loadedMessage("Configuration read and Key Values loaded to Consul.", unresolved)},
+			http.StatusOK, ConfigLoadResult{Token: body.Token, Subdomain: body.Subdomain, Keys: len(kvs_map), Unresolved: unresolved})
+	}
+}
+
+/*
+checkSubdomainKeys refuses keys of a service whose first / separated segment
+names one of its subdomains, such as a/b when a is a subdomain. They would be
+written as key b of the subdomain.
+*/
+func checkSubdomainKeys(token string, subdomain string, kvs map[string]string) error {
+	if subdomain != "" {
+		return nil
+	}
+	var nested []string
+	for key := range kvs {
+		if strings.Contains(key, "/") {
+			nested = append(nested, key)
+		}
+	}
+	if len(nested) == 0 {
+		return nil
+	}
+
+	subdomains, _, err := Directory.ListServiceSubdomains(token)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, s := range subdomains {
+		names[s.Subdomain] = true
+	}
+	var colliding []string
+	for _, key := range nested {
+		if names[key[:strings.Index(key, "/")]] {
+			colliding = append(colliding, key)
+		}
+	}
+	if len(colliding) > 0 {
+		sort.Strings(colliding)
+		return ConflictError("Keys " + strings.Join(colliding, ", ") + " collide with the keys of subdomains.")
+	}
+	return nil
+}
+
+// Config files that fail to parse, expand or render are the client's to fix, anything else is ours.
+func generateConfigReadError(w http.ResponseWriter, r *http.Request, err error) {
+	var req interface{}
+	detail := ErrorDetailV2{Code: ERROR_UNPROCESSABLE, Message: err.Error()}
+	switch e := err.(type) {
+	case ConfigErrors:
+		req = ResponseConfigErrorsStruct{Response: "Unable to parse config files.", Errors: e}
+		detail.Message = "Unable to parse config files."
+		detail.Files = e
+	case *UnresolvedVariablesError:
+		req = ResponseUnresolvedVariablesStruct{Response: e.Error(), Unresolved: e.Variables}
+		detail.Unresolved = e.Variables
+	case *ReferenceError:
+		req = ResponseReferenceErrorStruct{
+			Response: e.Error(), Unresolved: e.Unresolved, Cycles: e.Cycles, TooLarge: e.TooLarge}
+		detail.Unresolved = e.Unresolved
+		detail.Cycles = e.Cycles
+		detail.TooLarge = e.TooLarge
+	default:
+		GenerateErrorResponse(w, r, err)
+		return
 	}
+	if IsV2(r) {
+		generateErrorV2(w, detail)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(req)
+}
+
+// Reports the placeholders that were loaded unresolved after msg.
+func loadedMessage(msg string, unresolved []string) string {
+	if len(unresolved) == 0 {
+		return msg
+	}
+	return msg + " " + (&UnresolvedVariablesError{Variables: unresolved}).Error()
 }
 
 func HandleDefaultConfigLoad(w http.ResponseWriter, r *http.Request) {
-	kvs_map, err := KeyValues.ConfigReader("default", "", "")
+	if !Authorise(w, r, "", ROLE_ADMIN) {
+		return
+	}
+
+	kvs_map, err := KeyValues.ConfigReader("default", "", "", ConfigOptions{})
+	if err != nil {
+		generateConfigReadError(w, r, err)
+		return
+	}
+	err = checkSubdomainKeys("default", "", kvs_map)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+	managed, err := ManagedKeys("default", "", "", ConfigOptions{})
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		generateConfigReadError(w, r, err)
 		return
 	}
+	for key := range managed {
+		delete(kvs_map, key)
+	}
+	err = ExpandServiceReferences("default", kvs_map, managed, ConfigOptions{})
+	if err != nil {
+		generateConfigReadError(w, r, err)
+		return
+	}
+	variables, err := KeyValues.TemplateVariables("default", "")
+	if err != nil {
+		generateConfigReadError(w, r, err)
+		return
+	}
+	// The shipped defaults are templates, so unresolved placeholders are only reported.
+	unresolved := RenderTemplates(kvs_map, variables)
+	for key, value := range managed {
+		kvs_map[key] = value
+	}
 	err = KeyValues.WriteKVsToDatastore("default", "", kvs_map)
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, DatastoreError(err))
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Default Configuration read and default Key Values loaded to Consul.")
+		GenerateResult(w, r,
+			ResponseStringStruct{Response: loadedMessage("Default Configuration read and default Key Values loaded to Consul.", unresolved)},
+			http.StatusOK, ConfigLoadResult{Token: "default", Keys: len(kvs_map), Unresolved: unresolved})
 	}
 }
 
@@ -141,12 +355,22 @@ func HandleConfigGet(w http.ResponseWriter, r *http.Request) {
 	subdomain := vars["subdomain"]
 
 	if token == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "Token not passed.")
+		GenerateErrorResponse(w, r, InvalidError("Token not passed."))
 		return
 	}
 
 	if filename == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "filename not passed.")
+		GenerateErrorResponse(w, r, InvalidError("filename not passed."))
+		return
+	}
+
+	err := ValidatePathNames(token, subdomain, filename)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_READ_ONLY) {
 		return
 	}
 
@@ -160,20 +384,30 @@ func HandleConfigDelete(w http.ResponseWriter, r *http.Request) {
 	subdomain := vars["subdomain"]
 
 	if token == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "Token not passed.")
+		GenerateErrorResponse(w, r, InvalidError("Token not passed."))
 		return
 	}
 
 	if filename == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "filename not passed.")
+		GenerateErrorResponse(w, r, InvalidError("filename not passed."))
+		return
+	}
+
+	err := ValidatePathNames(token, subdomain, filename)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_WRITER) {
 		return
 	}
 
-	err := Directory.RemoveFile(token, subdomain, filename)
+	err = Directory.RemoveFile(token, subdomain, filename)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Deletion of config is successful.")
+		GenerateResult(w, r, ResponseStringStruct{Response: "Deletion of config is successful."}, http.StatusNoContent, nil)
 	}
 }
@@ -23,11 +23,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 )
 
 func RouterConfig() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(asPrincipal(AdminPrincipal))
 	router.HandleFunc("/v1/config", HandleConfigUpload).Methods("POST")
 	router.HandleFunc("/v1/config/{token}/{filename}", HandleConfigGet).Methods("GET")
 	router.HandleFunc("/v1/config/{token}/{filename}", HandleConfigDelete).Methods("DELETE")
@@ -192,7 +194,7 @@ func TestHandleConfigUpload_err(t *testing.T) {
 	response := httptest.NewRecorder()
 	RouterConfig().ServeHTTP(response, request)
 
-	assert.Equal(t, 500, response.Code, "500 response is expected")
+	assert.Equal(t, 400, response.Code, "400 response is expected")
 }
 
 func TestHandleDefaultConfigLoad(t *testing.T) {
@@ -232,3 +234,106 @@ func TestHandleDefaultConfigLoad_err(t *testing.T) {
 
 	assert.Equal(t, 500, response.Code, "500 response is expected")
 }
+
+func TestHandleConfigPOST_bad_format(t *testing.T) {
+	oldKeyValues := KeyValues
+	KeyValues = &FakeKeyValues{}
+	defer func() { KeyValues = oldKeyValues }()
+
+	body := &LoadConfigBody{
+		Token:    "test",
+		Filename: "test.xml",
+		Format:   "xml",
+	}
+
+	b, _ := json.Marshal(body)
+
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 400, response.Code, "400 response is expected")
+}
+
+func TestHandleConfigPOST_parse_errors(t *testing.T) {
+	oldDatastore := Datastore
+	oldKeyValues := KeyValues
+	oldMOUNTPATH := MOUNTPATH
+
+	dir := writeConfigFiles(map[string]string{
+		"test/broken.properties": "a=\\u12\n",
+	})
+	Datastore = &FakeConsul{}
+	KeyValues = &KeyValuesStruct{}
+	MOUNTPATH = dir + "/"
+
+	defer func() {
+		os.RemoveAll(dir)
+		Datastore = oldDatastore
+		KeyValues = oldKeyValues
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	body := &LoadConfigBody{Token: "test"}
+
+	b, _ := json.Marshal(body)
+
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 422, response.Code, "422 response is expected")
+
+	var resp ResponseConfigErrorsStruct
+	json.NewDecoder(response.Body).Decode(&resp)
+	if assert.Equal(t, 1, len(resp.Errors)) {
+		assert.Equal(t, "broken.properties", resp.Errors[0].File)
+		assert.Equal(t, 1, resp.Errors[0].Line)
+	}
+}
+
+func TestHandleConfigPOST_subdomainCollision(t *testing.T) {
+	oldDatastore := Datastore
+	oldKeyValues := KeyValues
+	oldDirectory := Directory
+	oldMOUNTPATH := MOUNTPATH
+
+	dir := writeConfigFiles(map[string]string{
+		"token1/service.yaml": "subdomain1:\n  url: x\nserver:\n  url: y\n",
+	})
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	KeyValues = &KeyValuesStruct{}
+	Directory = &FakeDirectory{}
+	MOUNTPATH = dir + "/"
+
+	defer func() {
+		os.RemoveAll(dir)
+		Datastore = oldDatastore
+		KeyValues = oldKeyValues
+		Directory = oldDirectory
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	b, _ := json.Marshal(&LoadConfigBody{Token: "token1", Separator: "/"})
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 409, response.Code, "subdomain1/url would be key url of subdomain1.")
+	assert.JSONEq(t, `{"response": "Keys subdomain1/url collide with the keys of subdomains.",
+		"error": {"code": "conflict"}}`, response.Body.String())
+	_, found, _ := Datastore.RequestGET("token1/", "server/url")
+	assert.False(t, found, "Nothing is loaded.")
+
+	b, _ = json.Marshal(&LoadConfigBody{Token: "token1"})
+	request, _ = http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response = httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	value, _, _ := Datastore.RequestGET("token1/", "subdomain1.url")
+	assert.Equal(t, "x", value)
+	_, found, _ = Datastore.RequestGET("token1/subdomain1/", "url")
+	assert.False(t, found)
+}
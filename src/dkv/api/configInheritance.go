@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+// Layers a resolved key can come from, from the least to the most specific.
+const (
+	LAYER_DEFAULT   = "default"
+	LAYER_SERVICE   = "service"
+	LAYER_SUBDOMAIN = "subdomain"
+)
+
+// EffectiveValue is the value a key resolves to and the layer it was found in.
+type EffectiveValue struct {
+	Value string `json:"value"`
+	Layer string `json:"layer"`
+}
+
+type configLayer struct {
+	Name   string
+	Token  string
+	Prefix string
+}
+
+/*
+configLayers returns the layers of token and subdomain, the most specific
+first, with the datastore prefixes their keys are written under.
+*/
+func configLayers(token string, subdomain string) []configLayer {
+	var layers []configLayer
+	if subdomain != "" {
+		layers = append(layers, configLayer{LAYER_SUBDOMAIN, token, datastorePrefix(token, subdomain)})
+	}
+	if token != "default" {
+		layers = append(layers, configLayer{LAYER_SERVICE, token, datastorePrefix(token, "")})
+	}
+	return append(layers, configLayer{LAYER_DEFAULT, "default", datastorePrefix("default", "")})
+}
+
+/*
+ResolveKey looks key up in the subdomain, then the service and then the default
+service. found is false when no layer has the key.
+*/
+func ResolveKey(token string, subdomain string, key string) (EffectiveValue, bool, error) {
+	for _, layer := range configLayers(token, subdomain) {
+		value, found, err := Datastore.RequestGET(layer.Prefix, key)
+		if err != nil {
+			return EffectiveValue{}, false, err
+		}
+		if found {
+			return EffectiveValue{Value: value, Layer: layer.Name}, true, nil
+		}
+	}
+	return EffectiveValue{}, false, nil
+}
+
+/*
+ResolveConfig merges every key of the default service, the service and the
+subdomain, the more specific layers taking precedence. Each layer is listed
+without the keys below it, so the keys of subdomains never show up as keys of
+their service.
+*/
+func ResolveConfig(token string, subdomain string) (map[string]EffectiveValue, error) {
+	layers := configLayers(token, subdomain)
+	effective := make(map[string]EffectiveValue)
+
+	// Least specific first, so more specific layers overwrite.
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		kvs, _, err := Datastore.RequestLIST(layer.Prefix, ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range kvs {
+			effective[kv.Key] = EffectiveValue{Value: kv.Value, Layer: layer.Name}
+		}
+	}
+	return effective, nil
+}
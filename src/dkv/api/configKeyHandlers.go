@@ -0,0 +1,149 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+)
+
+/*
+Keys can be written directly, without a config file, under the prefix loading
+configs writes them to. Values are written as they are, templates and ${key}
+references are not expanded. With ?reflect=true the keys are also written to
+the MANAGED_CONFIG_FILE of the service or subdomain, so that loading its
+directory again gives the same values.
+*/
+
+type PutKeyBody struct {
+	Value *string `json:"value"`
+}
+
+// HandleKeyPUT writes a single key, the value is given as {"value": "..."}.
+func HandleKeyPUT(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+	subdomain := vars["subdomain"]
+	key := vars["key"]
+
+	err := ValidatePathNames(token, subdomain, "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_WRITER) {
+		return
+	}
+
+	var body PutKeyBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Value == nil {
+		GenerateErrorResponse(w, r, InvalidError("Value not set. Please set value in PUT."))
+		return
+	}
+
+	kvs := map[string]string{key: *body.Value}
+	if !writeKeys(w, r, token, subdomain, kvs) {
+		return
+	}
+
+	GenerateResult(w, r, ResponseStringStruct{Response: "Key write successful."},
+		http.StatusOK, KeyResult{Key: key, Value: *body.Value, Layer: configLayers(token, subdomain)[0].Name})
+}
+
+// HandleKeysPATCH writes the keys of a JSON object of key value pairs, other keys are not touched.
+func HandleKeysPATCH(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+	subdomain := vars["subdomain"]
+
+	err := ValidatePathNames(token, subdomain, "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_WRITER) {
+		return
+	}
+
+	var kvs map[string]string
+	err = json.NewDecoder(r.Body).Decode(&kvs)
+	if err != nil {
+		GenerateErrorResponse(w, r, InvalidError("Body must be a JSON object of string values."))
+		return
+	}
+	if len(kvs) == 0 {
+		GenerateErrorResponse(w, r, InvalidError("No keys given."))
+		return
+	}
+	if _, found := kvs[""]; found {
+		GenerateErrorResponse(w, r, InvalidError("Key names may not be empty."))
+		return
+	}
+
+	if !writeKeys(w, r, token, subdomain, kvs) {
+		return
+	}
+
+	GenerateResult(w, r, ResponseStringStruct{Response: "Key Values written."},
+		http.StatusOK, ConfigLoadResult{Token: token, Subdomain: subdomain, Keys: len(kvs)})
+}
+
+/*
+writeKeys writes kvs for token or its subdomain and reports whether it did. The
+managed file is written first: should the datastore then fail, loading the
+directory again still brings the datastore in line with it.
+*/
+func writeKeys(w http.ResponseWriter, r *http.Request, token string, subdomain string, kvs map[string]string) bool {
+	err := findConfigDirectory(token, subdomain)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return false
+	}
+
+	if r.URL.Query().Get("reflect") == "true" {
+		err = KeyValues.UpdateManagedFile(token, subdomain, kvs, nil)
+		if err != nil {
+			generateConfigReadError(w, r, err)
+			return false
+		}
+	}
+
+	err = KeyValues.WriteKVsToDatastore(token, subdomain, kvs)
+	if err != nil {
+		GenerateErrorResponse(w, r, DatastoreError(err))
+		return false
+	}
+	return true
+}
+
+// Keys are only written for services and subdomains that have a directory in the mount.
+func findConfigDirectory(token string, subdomain string) error {
+	dir, err := MountPath(token, subdomain, "")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(dir)
+	if subdomain != "" {
+		return FilesystemError(err, "Subdomain "+subdomain)
+	}
+	return FilesystemError(err, "Service for Token: "+token)
+}
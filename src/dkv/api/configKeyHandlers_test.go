@@ -0,0 +1,206 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func RouterKeys() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(asPrincipal(AdminPrincipal))
+	router.HandleFunc("/v1/config/{token}/keys/{key}", HandleKeyPUT).Methods("PUT")
+	router.HandleFunc("/v1/config/{token}/{subdomain}/keys/{key}", HandleKeyPUT).Methods("PUT")
+	router.HandleFunc("/v1/config/{token}/keys", HandleKeysPATCH).Methods("PATCH")
+	router.HandleFunc("/v1/config/{token}/{subdomain}/keys", HandleKeysPATCH).Methods("PATCH")
+	router.HandleFunc("/v1/deleteconfig/{token}/{key}", HandleDELETE).Methods("DELETE")
+	return router
+}
+
+// Creates the directories of token1 and its subdomain sub1 with the real KeyValues.
+func setupKeys() func() {
+	cleanupMountpath := setupMountpath()
+	oldKeyValues := KeyValues
+	KeyValues = &KeyValuesStruct{}
+	os.MkdirAll(MOUNTPATH+"token1/sub1", 0770)
+
+	return func() {
+		cleanupMountpath()
+		KeyValues = oldKeyValues
+	}
+}
+
+func keysRequest(method string, url string, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	response := httptest.NewRecorder()
+	RouterKeys().ServeHTTP(response, request)
+	return response
+}
+
+func TestHandleKeyPUT(t *testing.T) {
+	cleanup := setupKeys()
+	defer cleanup()
+
+	response := keysRequest("PUT", "/v1/config/token1/keys/key1", `{"value": "value1"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"response": "Key write successful."}`, response.Body.String())
+
+	response = keysRequest("PUT", "/v1/config/token1/sub1/keys/key1", `{"value": ""}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	value, found, _ := Datastore.RequestGET("token1/", "key1")
+	assert.True(t, found)
+	assert.Equal(t, "value1", value)
+	value, found, _ = Datastore.RequestGET("token1/sub1/", "key1")
+	assert.True(t, found)
+	assert.Equal(t, "", value)
+
+	// Without reflect the mount is not touched.
+	_, err := os.Stat(MOUNTPATH + "token1/" + MANAGED_CONFIG_FILE)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHandleKeyPUT_err(t *testing.T) {
+	cleanup := setupKeys()
+	defer cleanup()
+
+	cases := []struct {
+		url  string
+		body string
+		code int
+	}{
+		{"/v1/config/token1/keys/key1", `{}`, http.StatusBadRequest},
+		{"/v1/config/token1/keys/key1", `{"value": 1}`, http.StatusBadRequest},
+		{"/v1/config/token$1/keys/key1", `{"value": "value1"}`, http.StatusBadRequest},
+		{"/v1/config/token2/keys/key1", `{"value": "value1"}`, http.StatusNotFound},
+		{"/v1/config/token1/sub2/keys/key1", `{"value": "value1"}`, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		response := keysRequest("PUT", c.url, c.body)
+		assert.Equal(t, c.code, response.Code, c.url+" "+c.body)
+	}
+
+	KeyValues = &FakeKeyValuesErr{}
+	response := keysRequest("PUT", "/v1/config/token1/keys/key1", `{"value": "value1"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+}
+
+func TestHandleKeysPATCH(t *testing.T) {
+	cleanup := setupKeys()
+	defer cleanup()
+
+	Datastore.RequestPUT("token1/sub1/", "key3", "value3")
+
+	response := keysRequest("PATCH", "/v1/config/token1/sub1/keys", `{"key1": "value1", "key2": "value2"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"response": "Key Values written."}`, response.Body.String())
+
+	kvs, _, _ := Datastore.RequestLIST("token1/sub1/", ListOptions{})
+	assert.Equal(t, []KeyValue{{"key1", "value1"}, {"key2", "value2"}, {"key3", "value3"}}, kvs)
+
+	cases := []struct {
+		body string
+		msg  string
+	}{
+		{`{}`, "No keys given."},
+		{`{"": "value1"}`, "Key names may not be empty."},
+		{`{"key1": 1}`, "Body must be a JSON object of string values."},
+		{`["key1"]`, "Body must be a JSON object of string values."},
+	}
+	for _, c := range cases {
+		response = keysRequest("PATCH", "/v1/config/token1/keys", c.body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, c.body)
+		assert.Contains(t, response.Body.String(), c.msg, c.body)
+	}
+}
+
+func TestHandleKeysPATCH_reflect(t *testing.T) {
+	cleanup := setupKeys()
+	defer cleanup()
+
+	ioutil.WriteFile(MOUNTPATH+"token1/service.properties", []byte("key1=file\nkey2=file\n"), 0660)
+	// Named to sort after the managed file, which is still read last.
+	ioutil.WriteFile(MOUNTPATH+"token1/zz.properties", []byte("key3=file\n"), 0660)
+
+	response := keysRequest("PATCH", "/v1/config/token1/keys?reflect=true",
+		`{"key1": "direct", "key3": "direct", "key4": "a = b\nc"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = keysRequest("PUT", "/v1/config/token1/keys/key5?reflect=true", `{"value": "${key1}"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	kvs, err := KeyValues.ConfigReader("token1", "", "", ConfigOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"key1": "direct", "key2": "file", "key3": "direct", "key4": "a = b\nc", "key5": "${key1}",
+	}, kvs)
+
+	response = keysRequest("DELETE", "/v1/deleteconfig/token1/key3?reflect=true", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	kvs, _ = KeyValues.ConfigReader("token1", "", "", ConfigOptions{})
+	assert.Equal(t, "file", kvs["key3"])
+	_, found, _ := Datastore.RequestGET("token1/", "key3")
+	assert.False(t, found)
+
+	// A managed file that no longer parses is reported and nothing is written.
+	ioutil.WriteFile(MOUNTPATH+"token1/"+MANAGED_CONFIG_FILE, []byte("key1=\\uZZZZ\n"), 0660)
+	response = keysRequest("PUT", "/v1/config/token1/keys/key6?reflect=true", `{"value": "value6"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	_, found, _ = Datastore.RequestGET("token1/", "key6")
+	assert.False(t, found)
+}
+
+func TestHandleKeysPATCH_reflectReferences(t *testing.T) {
+	cleanup := setupKeys()
+	defer cleanup()
+
+	ioutil.WriteFile(MOUNTPATH+"token1/service.properties",
+		[]byte("url=${a}\nhost=<%= @HOST %>\n"), 0660)
+	ioutil.WriteFile(MOUNTPATH+"token1/.variables", []byte("HOST=aai.onap\n"), 0660)
+
+	// Values are stored as they are, loading the directory again must give them back.
+	response := keysRequest("PATCH", "/v1/config/token1/keys?reflect=true",
+		`{"a": "${a}/x", "c": "${oops", "d": "<%= @HOST %>"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = keysRequest("PUT", "/v1/config/token1/keys/b?reflect=true", `{"value": "${c}"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	kvs := make(map[string]string)
+	err := ReadPropertiesFile(MOUNTPATH+"token1/"+MANAGED_CONFIG_FILE, ConfigOptions{}, &kvs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "${a}/x", "b": "${c}", "c": "${oops", "d": "<%= @HOST %>"}, kvs)
+
+	for _, body := range []string{`{"token": "token1"}`, `{"token": "token1", "filename": "` + MANAGED_CONFIG_FILE + `"}`} {
+		request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBufferString(body))
+		response = httptest.NewRecorder()
+		RouterConfig().ServeHTTP(response, request)
+		assert.Equal(t, http.StatusOK, response.Code, body+" "+response.Body.String())
+	}
+
+	kvList, _, _ := Datastore.RequestLIST("token1/", ListOptions{})
+	assert.Equal(t, []KeyValue{
+		{"a", "${a}/x"}, {"b", "${c}"}, {"c", "${oops"}, {"d", "<%= @HOST %>"},
+		{"host", "aai.onap"}, {"url", "${a}/x"},
+	}, kvList, "References to written keys take their values as they are.")
+}
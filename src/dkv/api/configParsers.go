@@ -0,0 +1,295 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigOptions controls how config files are read into key values.
+type ConfigOptions struct {
+	// Format overrides detection by file extension.
+	Format string
+	// Separator joins the keys of nested documents. Defaults to ".".
+	Separator string
+	// Include and Exclude select the files read from a directory, see ConfigFiles.
+	Include []string
+	Exclude []string
+}
+
+// ConfigParser reads the key values of a single config file into kvs.
+type ConfigParser func(string, ConfigOptions, *map[string]string) error
+
+const (
+	CONFIG_FORMAT_PROPERTIES = "properties"
+	CONFIG_FORMAT_YAML       = "yaml"
+	CONFIG_FORMAT_JSON       = "json"
+	CONFIG_FORMAT_TOML       = "toml"
+	CONFIG_FORMAT_INI        = "ini"
+	CONFIG_FORMAT_ENV        = "env"
+)
+
+var configParsers = map[string]ConfigParser{
+	CONFIG_FORMAT_PROPERTIES: ReadPropertiesFile,
+	CONFIG_FORMAT_YAML:       ReadYAMLFile,
+	CONFIG_FORMAT_JSON:       ReadJSONFile,
+	CONFIG_FORMAT_TOML:       ReadTOMLFile,
+	CONFIG_FORMAT_INI:        ReadINIFile,
+	CONFIG_FORMAT_ENV:        ReadEnvFile,
+}
+
+// Files with any other extension are read as properties, as they always were.
+var configExtensions = map[string]string{
+	".properties": CONFIG_FORMAT_PROPERTIES,
+	".yaml":       CONFIG_FORMAT_YAML,
+	".yml":        CONFIG_FORMAT_YAML,
+	".json":       CONFIG_FORMAT_JSON,
+	".toml":       CONFIG_FORMAT_TOML,
+	".ini":        CONFIG_FORMAT_INI,
+	// Also matches a file named just ".env".
+	".env": CONFIG_FORMAT_ENV,
+}
+
+func SupportedConfigFormats() []string {
+	var formats []string
+	for format := range configParsers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func ValidateConfigOptions(options ConfigOptions) error {
+	if options.Format != "" {
+		if _, found := configParsers[options.Format]; found == false {
+			return InvalidError("Unrecognised format. Supports only " + strings.Join(SupportedConfigFormats(), ", ") + ".")
+		}
+	}
+	if options.Separator != "" && options.Separator != "." && options.Separator != "/" {
+		return InvalidError("Unrecognised separator. Supports only . or /")
+	}
+	for _, pattern := range append(append([]string{}, options.Include...), options.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return InvalidError("Malformed pattern " + pattern + ".")
+		}
+	}
+	return nil
+}
+
+// DetectConfigFormat returns the format a file is read as.
+func DetectConfigFormat(path string, options ConfigOptions) string {
+	if options.Format != "" {
+		return options.Format
+	}
+	if format, found := configExtensions[strings.ToLower(filepath.Ext(path))]; found {
+		return format
+	}
+	return CONFIG_FORMAT_PROPERTIES
+}
+
+// Where the parsers report the line of an error.
+var (
+	propertiesErrorPattern = regexp.MustCompile(`^properties: Line (\d+): (.*)$`)
+	yamlErrorPattern       = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+	tomlErrorPattern       = regexp.MustCompile(`^Near line (\d+) \(last key parsed '.*'\): (.*)$`)
+)
+
+func ReadYAMLFile(path string, options ConfigOptions, kvs *map[string]string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	err = yaml.Unmarshal(raw, &doc)
+	if err != nil {
+		line, msg := parseErrorLine(yamlErrorPattern, err.Error())
+		return newConfigFileError(path, line, msg)
+	}
+	return flattenDocument(path, doc, options, kvs)
+}
+
+func ReadJSONFile(path string, options ConfigOptions, kvs *map[string]string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	// Keep numbers as written instead of going through float64.
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	err = decoder.Decode(&doc)
+	if err != nil {
+		var line = 0
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line = bytes.Count(raw[:syntaxErr.Offset], []byte("\n")) + 1
+		}
+		return newConfigFileError(path, line, err.Error())
+	}
+	return flattenDocument(path, doc, options, kvs)
+}
+
+func ReadTOMLFile(path string, options ConfigOptions, kvs *map[string]string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	_, err = toml.Decode(string(raw), &doc)
+	if err != nil {
+		line, msg := parseErrorLine(tomlErrorPattern, err.Error())
+		return newConfigFileError(path, line, msg)
+	}
+	return flattenDocument(path, doc, options, kvs)
+}
+
+/*
+ReadINIFile maps sections into the key hierarchy, so "port" in section
+"[server.http]" becomes "server.http.port". Keys before the first section are
+kept as they are.
+*/
+func ReadINIFile(path string, options ConfigOptions, kvs *map[string]string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := ini.Load(raw)
+	if err != nil {
+		return toConfigFileError(path, err)
+	}
+
+	separator := options.Separator
+	if separator == "" {
+		separator = "."
+	}
+
+	for _, section := range f.Sections() {
+		var prefix = ""
+		if section.Name() != ini.DefaultSection {
+			prefix = strings.Replace(section.Name(), ".", separator, -1) + separator
+		}
+		for _, key := range section.Keys() {
+			(*kvs)[prefix+key.Name()] = key.Value()
+		}
+	}
+	return nil
+}
+
+func ReadEnvFile(path string, options ConfigOptions, kvs *map[string]string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	envMap, err := godotenv.Unmarshal(string(raw))
+	if err != nil {
+		// The parser does not say where it failed, so find the line.
+		for i, line := range strings.Split(string(raw), "\n") {
+			if _, lineErr := godotenv.Unmarshal(line); lineErr != nil {
+				return newConfigFileError(path, i+1, lineErr.Error())
+			}
+		}
+		return newConfigFileError(path, 0, err.Error())
+	}
+
+	for key, value := range envMap {
+		(*kvs)[key] = value
+	}
+	return nil
+}
+
+func flattenDocument(path string, doc interface{}, options ConfigOptions, kvs *map[string]string) error {
+	// An empty file.
+	if doc == nil {
+		return nil
+	}
+
+	switch doc.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+	default:
+		return newConfigFileError(path, 0, "top level must be a mapping of keys.")
+	}
+
+	separator := options.Separator
+	if separator == "" {
+		separator = "."
+	}
+	FlattenKeyValues("", doc, separator, kvs)
+	return nil
+}
+
+/*
+FlattenKeyValues writes the leaves of a nested document into kvs, joining the
+keys on the way with separator. Array elements are keyed by their index, so
+"servers: [{host: a}]" becomes "servers.0.host=a". Null values become empty
+strings and empty mappings or arrays produce no keys.
+*/
+func FlattenKeyValues(prefix string, value interface{}, separator string, kvs *map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + separator + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			FlattenKeyValues(join(key), child, separator, kvs)
+		}
+	case map[interface{}]interface{}:
+		// YAML allows keys that are not strings.
+		for key, child := range v {
+			FlattenKeyValues(join(fmt.Sprint(key)), child, separator, kvs)
+		}
+	case []interface{}:
+		for i, child := range v {
+			FlattenKeyValues(join(strconv.Itoa(i)), child, separator, kvs)
+		}
+	case []map[string]interface{}:
+		// TOML arrays of tables.
+		for i, child := range v {
+			FlattenKeyValues(join(strconv.Itoa(i)), child, separator, kvs)
+		}
+	case time.Time:
+		// TOML datetimes.
+		(*kvs)[prefix] = v.Format(time.RFC3339Nano)
+	case nil:
+		(*kvs)[prefix] = ""
+	case float64:
+		(*kvs)[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		(*kvs)[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,495 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes files, given relative to a new temporary directory, and returns the directory.
+func writeConfigFiles(files map[string]string) string {
+	dir, _ := ioutil.TempDir("", "dkv-config")
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0770)
+		ioutil.WriteFile(path, []byte(content), 0660)
+	}
+	return dir
+}
+
+const testYAML = `
+server:
+  host: aai.onap
+  port: 8443
+  tls: true
+  ratio: 0.5
+hosts:
+  - a
+  - b
+servers:
+  - name: one
+    weight: 1
+  - name: two
+empty:
+nothing: {}
+`
+
+func TestDetectConfigFormat(t *testing.T) {
+	assert.Equal(t, "yaml", DetectConfigFormat("a/b.yaml", ConfigOptions{}))
+	assert.Equal(t, "yaml", DetectConfigFormat("a/b.YML", ConfigOptions{}))
+	assert.Equal(t, "json", DetectConfigFormat("a/b.json", ConfigOptions{}))
+	assert.Equal(t, "properties", DetectConfigFormat("a/b.properties", ConfigOptions{}))
+	assert.Equal(t, "toml", DetectConfigFormat("a/b.toml", ConfigOptions{}))
+	assert.Equal(t, "ini", DetectConfigFormat("a/b.ini", ConfigOptions{}))
+	assert.Equal(t, "env", DetectConfigFormat("a/.env", ConfigOptions{}))
+	assert.Equal(t, "env", DetectConfigFormat("a/prod.env", ConfigOptions{}))
+	// Anything else is read as properties, as before.
+	assert.Equal(t, "properties", DetectConfigFormat("a/b.conf", ConfigOptions{}))
+	assert.Equal(t, "properties", DetectConfigFormat("a/b", ConfigOptions{}))
+
+	assert.Equal(t, "json", DetectConfigFormat("a/b.yaml", ConfigOptions{Format: "json"}))
+}
+
+func TestValidateConfigOptions(t *testing.T) {
+	assert.Nil(t, ValidateConfigOptions(ConfigOptions{}))
+	assert.Nil(t, ValidateConfigOptions(ConfigOptions{Format: "yaml", Separator: "/"}))
+	assert.NotNil(t, ValidateConfigOptions(ConfigOptions{Format: "xml"}))
+	assert.NotNil(t, ValidateConfigOptions(ConfigOptions{Separator: ":"}))
+}
+
+func TestReadYAMLFile(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{"test.yaml": testYAML})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadYAMLFile(filepath.Join(dir, "test.yaml"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"server.host":      "aai.onap",
+		"server.port":      "8443",
+		"server.tls":       "true",
+		"server.ratio":     "0.5",
+		"hosts.0":          "a",
+		"hosts.1":          "b",
+		"servers.0.name":   "one",
+		"servers.0.weight": "1",
+		"servers.1.name":   "two",
+		"empty":            "",
+	}, kvs)
+}
+
+func TestReadYAMLFile_separator(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{"test.yaml": "a:\n  b:\n    - c: d\n"})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadYAMLFile(filepath.Join(dir, "test.yaml"), ConfigOptions{Separator: "/"}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a/b/0/c": "d"}, kvs)
+}
+
+func TestReadJSONFile(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{
+		"test.json": `{"server": {"host": "aai.onap", "port": 8443, "timeout": 1.50, "tls": false},
+			"hosts": ["a", "b"], "proxy": null, "empty": []}`,
+	})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadJSONFile(filepath.Join(dir, "test.json"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"server.host":    "aai.onap",
+		"server.port":    "8443",
+		"server.timeout": "1.50",
+		"server.tls":     "false",
+		"hosts.0":        "a",
+		"hosts.1":        "b",
+		"proxy":          "",
+	}, kvs)
+}
+
+func TestReadJSONFile_err(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{
+		"broken.json": `{"a": `,
+		"list.json":   `["a", "b"]`,
+		"broken.yaml": "a: [b",
+		"empty.yaml":  "",
+	})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadJSONFile(filepath.Join(dir, "broken.json"), ConfigOptions{}, &kvs)
+	assert.Contains(t, err.Error(), "broken.json")
+	assert.NotContains(t, err.Error(), dir, "The mount path should not be shown.")
+
+	err = ReadJSONFile(filepath.Join(dir, "list.json"), ConfigOptions{}, &kvs)
+	assert.Contains(t, err.Error(), "top level")
+
+	err = ReadYAMLFile(filepath.Join(dir, "broken.yaml"), ConfigOptions{}, &kvs)
+	assert.Contains(t, err.Error(), "broken.yaml")
+
+	err = ReadYAMLFile(filepath.Join(dir, "empty.yaml"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Empty(t, kvs)
+}
+
+func TestConfigReader_formats(t *testing.T) {
+	oldMOUNTPATH := MOUNTPATH
+	dir := writeConfigFiles(map[string]string{
+		"token1/a.properties": "a.key=1\n",
+		"token1/b.yaml":       "b:\n  key: 2\n",
+		"token1/sub1/c.json":  `{"c": {"key": 3}}`,
+		"token2/d.settings":   `{"d": {"key": 4}}`,
+	})
+	MOUNTPATH = dir + "/"
+	defer func() {
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kv := &KeyValuesStruct{}
+
+	kvs, err := kv.ConfigReader("token1", "", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", kvs["a.key"])
+	assert.Equal(t, "2", kvs["b.key"])
+	assert.NotContains(t, kvs, "c.key")
+
+	kvs, err = kv.ConfigReader("token1", "sub1", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"c.key": "3"}, kvs)
+
+	kvs, err = kv.ConfigReader("token1", "", "b.yaml", ConfigOptions{Separator: "/"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"b/key": "2"}, kvs)
+
+	kvs, err = kv.ConfigReader("token2", "", "d.settings", ConfigOptions{Format: "json"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"d.key": "4"}, kvs)
+}
+
+func TestReadTOMLFile(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{"test.toml": `
+title = "dkv"
+started = 2018-05-27T07:32:00Z
+
+[server]
+host = "aai.onap"
+port = 8443
+ratio = 0.5
+
+[server.tls]
+enabled = true
+
+[[servers]]
+name = "one"
+
+[[servers]]
+name = "two"
+ports = [1, 2]
+`})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadTOMLFile(filepath.Join(dir, "test.toml"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"title":              "dkv",
+		"started":            "2018-05-27T07:32:00Z",
+		"server.host":        "aai.onap",
+		"server.port":        "8443",
+		"server.ratio":       "0.5",
+		"server.tls.enabled": "true",
+		"servers.0.name":     "one",
+		"servers.1.name":     "two",
+		"servers.1.ports.0":  "1",
+		"servers.1.ports.1":  "2",
+	}, kvs)
+}
+
+func TestReadINIFile(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{"test.ini": `
+; comment
+name = dkv
+
+[server]
+host = aai.onap
+port = 8443
+
+[server.tls]
+enabled = true
+`})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadINIFile(filepath.Join(dir, "test.ini"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"name":               "dkv",
+		"server.host":        "aai.onap",
+		"server.port":        "8443",
+		"server.tls.enabled": "true",
+	}, kvs)
+
+	kvs = make(map[string]string)
+	err = ReadINIFile(filepath.Join(dir, "test.ini"), ConfigOptions{Separator: "/"}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, "true", kvs["server/tls/enabled"])
+}
+
+func TestReadEnvFile(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{".env": `
+# comment
+DB_HOST=mariadb
+export DB_PORT=3306
+DB_PASSWORD="a b=c"
+`})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadEnvFile(filepath.Join(dir, ".env"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"DB_HOST":     "mariadb",
+		"DB_PORT":     "3306",
+		"DB_PASSWORD": "a b=c",
+	}, kvs)
+}
+
+func TestReadConfigFile_parseErrors(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{
+		"broken.toml": "a = 1\nb = [\n",
+		"broken.ini":  "[server\nhost = a\n",
+		"broken.env":  "A=1\nB\n",
+	})
+	defer os.RemoveAll(dir)
+
+	kv := &KeyValuesStruct{}
+	for _, name := range []string{"broken.toml", "broken.ini", "broken.env"} {
+		kvs := make(map[string]string)
+		err := kv.ReadConfigFile(filepath.Join(dir, name), ConfigOptions{}, &kvs)
+		if assert.NotNil(t, err, name) {
+			assert.Contains(t, err.Error(), name)
+			assert.NotContains(t, err.Error(), dir, "The mount path should not be shown.")
+		}
+	}
+
+	kvs := make(map[string]string)
+	err := kv.ReadConfigFile(filepath.Join(dir, "broken.env"), ConfigOptions{}, &kvs)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestConfigReader_mixed(t *testing.T) {
+	oldMOUNTPATH := MOUNTPATH
+	dir := writeConfigFiles(map[string]string{
+		"token1/a.properties": "a.key=1\n",
+		"token1/b.toml":       "[b]\nkey = 2\n",
+		"token1/c.ini":        "[c]\nkey = 3\n",
+		"token1/.env":         "D_KEY=4\n",
+	})
+	MOUNTPATH = dir + "/"
+	defer func() {
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kvs, err := (&KeyValuesStruct{}).ConfigReader("token1", "", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"a.key": "1",
+		"b.key": "2",
+		"c.key": "3",
+		"D_KEY": "4",
+	}, kvs)
+}
+
+func TestReadPropertiesFile_err(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{
+		"broken.properties": "a=1\nb=\\u12\n",
+	})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadPropertiesFile(filepath.Join(dir, "broken.properties"), ConfigOptions{}, &kvs)
+	if assert.NotNil(t, err) {
+		fileErr := err.(*ConfigFileError)
+		assert.Equal(t, "broken.properties", fileErr.File)
+		assert.Equal(t, 2, fileErr.Line)
+		assert.NotContains(t, err.Error(), dir, "The mount path should not be shown.")
+	}
+}
+
+func TestConfigReader_parseErrors(t *testing.T) {
+	oldMOUNTPATH := MOUNTPATH
+	dir := writeConfigFiles(map[string]string{
+		"token1/sub1/a.properties": "a.key=1\n",
+		"token1/sub1/b.properties": "b.key=\\u12\n",
+		"token1/sub1/c.json":       `{"c": `,
+		"token1/sub1/d.properties": "d.key=4\n",
+	})
+	MOUNTPATH = dir + "/"
+	defer func() {
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kv := &KeyValuesStruct{}
+
+	kvs, err := kv.ConfigReader("token1", "sub1", "", ConfigOptions{})
+	configErrs, ok := err.(ConfigErrors)
+	if assert.True(t, ok, "ConfigErrors is expected") {
+		assert.Equal(t, 2, len(configErrs))
+		assert.Equal(t, "b.properties", configErrs[0].File)
+		assert.Equal(t, 1, configErrs[0].Line)
+		assert.Equal(t, "c.json", configErrs[1].File)
+	}
+	assert.NotContains(t, err.Error(), dir, "The mount path should not be shown.")
+	assert.Equal(t, "1", kvs["a.key"], "Files that parse are still read.")
+	assert.Equal(t, "4", kvs["d.key"], "Files that parse are still read.")
+
+	_, err = kv.ConfigReader("token1", "sub1", "b.properties", ConfigOptions{})
+	configErrs, ok = err.(ConfigErrors)
+	if assert.True(t, ok, "ConfigErrors is expected") {
+		assert.Equal(t, "b.properties", configErrs[0].File)
+	}
+
+	_, err = kv.ConfigReader("token1", "", "missing.properties", ConfigOptions{})
+	assert.Contains(t, err.Error(), "missing.properties")
+}
+
+func TestConfigReader_parseErrorsTOMLINI(t *testing.T) {
+	oldMOUNTPATH := MOUNTPATH
+	dir := writeConfigFiles(map[string]string{
+		"token1/a.toml": "a = \n",
+		"token1/b.ini":  "[b\nkey = 1\n",
+	})
+	MOUNTPATH = dir + "/"
+	defer func() {
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kv := &KeyValuesStruct{}
+
+	_, err := kv.ConfigReader("token1", "", "", ConfigOptions{})
+	configErrs, ok := err.(ConfigErrors)
+	if assert.True(t, ok, "ConfigErrors is expected") {
+		assert.Equal(t, 2, len(configErrs))
+		assert.Equal(t, "a.toml", configErrs[0].File)
+		assert.Equal(t, "b.ini", configErrs[1].File)
+	}
+	assert.NotContains(t, err.Error(), dir, "The mount path should not be shown.")
+
+	kvs := make(map[string]string)
+	for _, parser := range []ConfigParser{ReadTOMLFile, ReadINIFile} {
+		err = parser(filepath.Join(dir, "missing"), ConfigOptions{}, &kvs)
+		if assert.NotNil(t, err) {
+			assert.NotContains(t, toConfigFileError("missing", err).Error(), dir, "The mount path should not be shown.")
+		}
+	}
+}
+
+func TestReadPropertiesFile_references(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{
+		"a.properties": "home=${HOME}\nurl=${host}/aai\n",
+	})
+	defer os.RemoveAll(dir)
+
+	kvs := make(map[string]string)
+	err := ReadPropertiesFile(filepath.Join(dir, "a.properties"), ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"home": "${HOME}", "url": "${host}/aai"}, kvs,
+		"References are left for ExpandReferences, never read from the environment.")
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := writeConfigFiles(map[string]string{
+		"b.properties":          "",
+		"a.yaml":                "",
+		".variables":            "",
+		"a/z.properties":        "",
+		"a/deeper/x.properties": "",
+		"a/deeper/y.json":       "",
+		"b/c.properties":        "",
+		"tmp/d.properties":      "",
+	})
+	defer os.RemoveAll(dir)
+
+	files, err := ConfigFiles(dir, false, ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.yaml", "b.properties"}, files)
+
+	files, err = ConfigFiles(dir, true, ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"a.yaml",
+		"b.properties",
+		"a/z.properties",
+		"b/c.properties",
+		"tmp/d.properties",
+	}, files, "Subdomains are read one level deep.")
+
+	files, err = ConfigFiles(dir, true, ConfigOptions{Include: []string{"*.properties"}, Exclude: []string{"tmp", "b/c.*"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b.properties", "a/z.properties"}, files)
+
+	_, err = ConfigFiles(filepath.Join(dir, "missing"), true, ConfigOptions{})
+	assert.NotNil(t, err)
+
+	err = ValidateConfigOptions(ConfigOptions{Exclude: []string{"[a"}})
+	assert.Equal(t, "Malformed pattern [a.", err.Error())
+}
+
+func TestConfigReader_overrides(t *testing.T) {
+	oldMOUNTPATH := MOUNTPATH
+	dir := writeConfigFiles(map[string]string{
+		"token1/z.properties":             "key=service\nservice=1\n",
+		"token1/sub1/a.properties":        "key=sub1\nsub1=1\n",
+		"token1/sub1/b.properties":        "key=sub1b\n",
+		"token1/sub1/nested/a.properties": "key=nested\nnested=1\n",
+		"token1/sub2/a.properties":        "sub2=1\n",
+	})
+	MOUNTPATH = dir + "/"
+	defer func() {
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kv := &KeyValuesStruct{}
+
+	kvs, err := kv.ConfigReader("token1", "sub1", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key": "sub1b", "sub1": "1"}, kvs,
+		"Only the files of the subdomain are read, later files override.")
+
+	kvs, err = kv.ConfigReader("token1", "sub1", "", ConfigOptions{Exclude: []string{"b.*"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key": "sub1", "sub1": "1"}, kvs)
+
+	_, err = kv.ConfigReader("token1", "sub1/nested", "", ConfigOptions{})
+	assert.Equal(t, "Invalid subdomain.", err.Error())
+
+	kvs, err = kv.ConfigReader("token1", "", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key": "service", "service": "1"}, kvs,
+		"Subdomains are loaded under their own prefix, not with the service.")
+}
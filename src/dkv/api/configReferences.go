@@ -0,0 +1,249 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches ${key} references to other keys.
+var referencePattern = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+// Consul refuses larger values, so an expansion growing past it is an error.
+const MAX_EXPANDED_VALUE_SIZE = 512 * 1024
+
+// ReferenceError lists the references that could not be expanded.
+type ReferenceError struct {
+	Unresolved []string
+	Cycles     []string
+	TooLarge   []string
+}
+
+func (e *ReferenceError) Error() string {
+	var msgs []string
+	if len(e.Unresolved) > 0 {
+		msgs = append(msgs, "Unresolved references: "+strings.Join(e.Unresolved, ", ")+".")
+	}
+	if len(e.Cycles) > 0 {
+		msgs = append(msgs, "Circular references: "+strings.Join(e.Cycles, "; ")+".")
+	}
+	if len(e.TooLarge) > 0 {
+		msgs = append(msgs, "Expanded values too large: "+strings.Join(e.TooLarge, ", ")+".")
+	}
+	return strings.Join(msgs, " ")
+}
+
+// scopedKey is a key of scopes[scope].
+type scopedKey struct {
+	scope int
+	key   string
+}
+
+type referenceExpander struct {
+	scopes []map[string]string
+	// Each key is expanded once, however often it is referenced.
+	expanded   map[scopedKey]string
+	unresolved map[string]bool
+	cycles     map[string]bool
+	tooLarge   map[string]bool
+}
+
+/*
+value returns the expanded value of k. References are looked up from the scope
+of k onwards, so a value never depends on the scopes before its own. path holds
+the keys being expanded, to find cycles.
+*/
+func (x *referenceExpander) value(k scopedKey, path []scopedKey) string {
+	if value, found := x.expanded[k]; found {
+		return value
+	}
+	for j := range path {
+		if path[j] == k {
+			x.cycles[cycleString(path[j:])] = true
+			return "${" + k.key + "}"
+		}
+	}
+
+	value, ok := x.expand(x.scopes[k.scope][k.key], k.scope, append(path, k))
+	if ok == false {
+		x.tooLarge[k.key] = true
+	}
+	x.expanded[k] = value
+	return value
+}
+
+// expand replaces the references in raw. It gives up, returning raw and false, past MAX_EXPANDED_VALUE_SIZE.
+func (x *referenceExpander) expand(raw string, scope int, path []scopedKey) (string, bool) {
+	matches := referencePattern.FindAllStringSubmatchIndex(raw, -1)
+	if len(matches) == 0 {
+		return raw, true
+	}
+
+	var expanded strings.Builder
+	last := 0
+	for _, match := range matches {
+		expanded.WriteString(raw[last:match[0]])
+		expanded.WriteString(x.reference(raw[match[2]:match[3]], scope, path))
+		last = match[1]
+		if expanded.Len()+len(raw)-last > MAX_EXPANDED_VALUE_SIZE {
+			return raw, false
+		}
+	}
+	expanded.WriteString(raw[last:])
+	return expanded.String(), true
+}
+
+// reference returns the expanded value of key in the first scope from scope on that has it.
+func (x *referenceExpander) reference(key string, scope int, path []scopedKey) string {
+	for i := scope; i < len(x.scopes); i++ {
+		if _, found := x.scopes[i][key]; found {
+			return x.value(scopedKey{i, key}, path)
+		}
+	}
+	x.unresolved[key] = true
+	return "${" + key + "}"
+}
+
+// Formats a cycle starting from its smallest key, so each cycle is reported once.
+func cycleString(cycle []scopedKey) string {
+	start := 0
+	for i := range cycle {
+		if cycle[i].key < cycle[start].key {
+			start = i
+		}
+	}
+	var keys []string
+	for i := range cycle {
+		keys = append(keys, cycle[(start+i)%len(cycle)].key)
+	}
+	return strings.Join(append(keys, keys[0]), " -> ")
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/*
+ExpandReferences expands the ${key} references in the values of scopes[0]. Each
+key is looked up in scopes[0] first and then in the following scopes in order.
+Unless every reference resolves and no value grows past MAX_EXPANDED_VALUE_SIZE,
+scopes[0] is left untouched and a ReferenceError is returned.
+*/
+func ExpandReferences(scopes []map[string]string) error {
+	return expandReferences(scopes, nil)
+}
+
+// expandReferences is ExpandReferences, with the values of the scopes marked literal taken as they are.
+func expandReferences(scopes []map[string]string, literal []bool) error {
+	x := &referenceExpander{
+		scopes:     scopes,
+		expanded:   make(map[scopedKey]string),
+		unresolved: make(map[string]bool),
+		cycles:     make(map[string]bool),
+		tooLarge:   make(map[string]bool),
+	}
+	for i := range literal {
+		if literal[i] {
+			for key, value := range scopes[i] {
+				x.expanded[scopedKey{i, key}] = value
+			}
+		}
+	}
+
+	expanded := make(map[string]string)
+	for key := range scopes[0] {
+		expanded[key] = x.value(scopedKey{0, key}, nil)
+	}
+
+	if len(x.unresolved) > 0 || len(x.cycles) > 0 || len(x.tooLarge) > 0 {
+		return &ReferenceError{
+			Unresolved: sortedKeys(x.unresolved),
+			Cycles:     sortedKeys(x.cycles),
+			TooLarge:   sortedKeys(x.tooLarge),
+		}
+	}
+	for key, value := range expanded {
+		scopes[0][key] = value
+	}
+	return nil
+}
+
+func hasReferences(kvs map[string]string) bool {
+	for _, value := range kvs {
+		if referencePattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ExpandServiceReferences expands the references in kvs, loaded for the service
+token, against kvs itself, then managed, then all the config of the service,
+subdomains included, and then the config of the default service. The keys of
+managed and of every MANAGED_CONFIG_FILE were written directly, so references
+take their values as they are. A format override only applies to the loaded
+files, so only the separator is passed on.
+*/
+func ExpandServiceReferences(
+	token string, kvs map[string]string, managed map[string]string, options ConfigOptions) error {
+
+	if hasReferences(kvs) == false {
+		return nil
+	}
+
+	scopes := []map[string]string{kvs, managed}
+	literal := []bool{false, true}
+	tokens := []string{token}
+	if token != "default" {
+		tokens = append(tokens, "default")
+	}
+	for _, scopeToken := range tokens {
+		dir, err := MountPath(scopeToken, "", "")
+		if err != nil {
+			return err
+		}
+		scopeManaged, err := readReferenceScope(dir, ConfigOptions{Include: []string{MANAGED_CONFIG_FILE}})
+		if err != nil {
+			return err
+		}
+		scope, err := readReferenceScope(dir, ConfigOptions{Separator: options.Separator, Exclude: []string{MANAGED_CONFIG_FILE}})
+		if err != nil {
+			return err
+		}
+		scopes = append(scopes, scopeManaged, scope)
+		literal = append(literal, true, false)
+	}
+	return expandReferences(scopes, literal)
+}
+
+// Files of a lookup scope that fail to parse are skipped, they only fail their own load.
+func readReferenceScope(dir string, options ConfigOptions) (map[string]string, error) {
+	scope := make(map[string]string)
+	err := KeyValues.ReadConfigDirectory(dir, true, options, &scope)
+	if _, ok := err.(ConfigErrors); err != nil && ok == false && ErrorCode(err) != ERROR_NOT_FOUND {
+		return scope, err
+	}
+	return scope, nil
+}
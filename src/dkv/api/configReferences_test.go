@@ -0,0 +1,224 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExpandReferences(t *testing.T) {
+	kvs := map[string]string{
+		"aai.server.url": "https://${aai.host}:${aai.port}",
+		"aai.host":       "aai.onap",
+		"aai.events.url": "${aai.server.url}/events",
+	}
+	service := map[string]string{"aai.port": "8443"}
+	defaults := map[string]string{
+		"aai.port": "9999",
+		"timeout":  "${retries}0",
+		"retries":  "3",
+	}
+	kvs["aai.timeout"] = "${timeout}"
+
+	err := ExpandReferences([]map[string]string{kvs, service, defaults})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"aai.server.url": "https://aai.onap:8443",
+		"aai.host":       "aai.onap",
+		"aai.events.url": "https://aai.onap:8443/events",
+		"aai.timeout":    "30",
+	}, kvs)
+}
+
+func TestExpandReferences_err(t *testing.T) {
+	kvs := map[string]string{
+		"a": "${b}",
+		"b": "x${c}",
+		"c": "${a}",
+		"d": "${missing} ${e}",
+	}
+	defaults := map[string]string{
+		"e": "${d}",
+	}
+
+	err := ExpandReferences([]map[string]string{kvs, defaults})
+	refErr, ok := err.(*ReferenceError)
+	if assert.True(t, ok, "ReferenceError is expected") {
+		assert.Equal(t, []string{"d", "missing"}, refErr.Unresolved,
+			"Values of a later scope are not expanded against earlier scopes.")
+		assert.Equal(t, []string{"a -> b -> c -> a"}, refErr.Cycles)
+	}
+	assert.Equal(t, "${b}", kvs["a"], "Nothing is expanded on error.")
+}
+
+// Each key references the next twice, so its value doubles in size down the chain.
+func doublingReferences(n int) map[string]string {
+	kvs := make(map[string]string)
+	for i := 0; i < n; i++ {
+		next := "${k" + strconv.Itoa(i+1) + "}"
+		kvs["k"+strconv.Itoa(i)] = next + next
+	}
+	return kvs
+}
+
+func TestExpandReferences_shared(t *testing.T) {
+	kvs := doublingReferences(16)
+	defaults := map[string]string{"k16": "x"}
+
+	err := ExpandReferences([]map[string]string{kvs, defaults})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("x", 1<<16), kvs["k0"])
+
+	// Expanded naively this takes 2^27 expansions and k0 grows to 768 MiB.
+	kvs = doublingReferences(27)
+	err = ExpandReferences([]map[string]string{kvs})
+	refErr, ok := err.(*ReferenceError)
+	if assert.True(t, ok, "ReferenceError is expected") {
+		assert.Equal(t, []string{"k27"}, refErr.Unresolved)
+		assert.Equal(t, []string{"k10"}, refErr.TooLarge)
+		assert.Contains(t, refErr.Error(), "Expanded values too large: k10.")
+	}
+	assert.Equal(t, "${k1}${k1}", kvs["k0"], "Nothing is expanded on error.")
+}
+
+func TestHandleConfigPOST_references(t *testing.T) {
+	oldDatastore := Datastore
+	oldKeyValues := KeyValues
+	oldMOUNTPATH := MOUNTPATH
+
+	dir := writeConfigFiles(map[string]string{
+		"default/a.properties":     "aai.port=8443\n",
+		"token1/b.properties":      "aai.host=aai.onap\n",
+		"token1/sub1/c.properties": "aai.url=https://${aai.host}:${aai.port}\n",
+		"token1/sub2/d.properties": "aai.events=${aai.url}/events\n",
+		"token1/sub3/e.yaml":       "aai:\n  user: ${aai.user}\n",
+	})
+	Datastore = &MemoryStruct{}
+	Datastore.InitializeDatastoreClient()
+	KeyValues = &KeyValuesStruct{}
+	MOUNTPATH = dir + "/"
+
+	defer func() {
+		os.RemoveAll(dir)
+		Datastore = oldDatastore
+		KeyValues = oldKeyValues
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	load := func(body LoadConfigBody) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+		response := httptest.NewRecorder()
+		RouterConfig().ServeHTTP(response, request)
+		return response
+	}
+
+	response := load(LoadConfigBody{Token: "token1", Subdomain: "sub2"})
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	value, _, _ := Datastore.RequestGET("token1/sub2/", "aai.events")
+	assert.Equal(t, "https://aai.onap:8443/events", value)
+
+	response = load(LoadConfigBody{Token: "token1"})
+	assert.Equal(t, 200, response.Code, "The broken subdomain is not part of the service load.")
+	_, found, _ := Datastore.RequestGET("token1/", "aai.url")
+	assert.False(t, found)
+
+	response = load(LoadConfigBody{Token: "token1", Subdomain: "sub3"})
+	assert.Equal(t, 422, response.Code, "422 response is expected")
+	var resp ResponseReferenceErrorStruct
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, []string{"aai.user -> aai.user"}, resp.Cycles)
+	_, found, _ = Datastore.RequestGET("token1/sub3/", "aai.user")
+	assert.False(t, found, "Nothing is loaded.")
+}
+
+func TestHandleConfigPOST_referencesBrokenFile(t *testing.T) {
+	oldDatastore := Datastore
+	oldKeyValues := KeyValues
+	oldMOUNTPATH := MOUNTPATH
+
+	dir := writeConfigFiles(map[string]string{
+		"default/a.properties":     "aai.port=8443\n",
+		"default/broken.json":      `{"aai": `,
+		"token1/b.properties":      "aai.url=https://aai.onap:${aai.port}\n",
+		"token1/sub1/c.properties": "broken=\\u12\n",
+	})
+	Datastore = &MemoryStruct{}
+	Datastore.InitializeDatastoreClient()
+	KeyValues = &KeyValuesStruct{}
+	MOUNTPATH = dir + "/"
+
+	defer func() {
+		os.RemoveAll(dir)
+		Datastore = oldDatastore
+		KeyValues = oldKeyValues
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	b, _ := json.Marshal(LoadConfigBody{Token: "token1", Filename: "b.properties"})
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "Files that fail elsewhere do not fail this load.")
+	value, _, _ := Datastore.RequestGET("token1/", "aai.url")
+	assert.Equal(t, "https://aai.onap:8443", value)
+}
+
+func TestHandleConfigPOST_referenceCycleInFile(t *testing.T) {
+	oldDatastore := Datastore
+	oldKeyValues := KeyValues
+	oldMOUNTPATH := MOUNTPATH
+
+	dir := writeConfigFiles(map[string]string{
+		"token1/cycle.properties": "a=${b}/x\nb=${a}\nc=${c\n",
+	})
+	Datastore = &MemoryStruct{}
+	Datastore.InitializeDatastoreClient()
+	KeyValues = &KeyValuesStruct{}
+	MOUNTPATH = dir + "/"
+
+	defer func() {
+		os.RemoveAll(dir)
+		Datastore = oldDatastore
+		KeyValues = oldKeyValues
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kvs := make(map[string]string)
+	err := ReadPropertiesFile(MOUNTPATH+"token1/cycle.properties", ConfigOptions{}, &kvs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "${b}/x", "b": "${a}", "c": "${c"}, kvs)
+
+	b, _ := json.Marshal(LoadConfigBody{Token: "token1", Filename: "cycle.properties"})
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+
+	assert.Equal(t, 422, response.Code, "422 response is expected")
+	var resp ResponseReferenceErrorStruct
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, []string{"a -> b -> a"}, resp.Cycles)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+TEMPLATE_VARIABLES_FILE holds the template variables of a service or of a
+subdomain, in properties format. It is not loaded as config itself.
+*/
+const TEMPLATE_VARIABLES_FILE = ".variables"
+
+// Matches ERB style placeholders such as <%= @AAI_SERVER_URL %>.
+var templatePattern = regexp.MustCompile(`<%=\s*@(\w+)\s*%>`)
+
+// UnresolvedVariablesError lists the template variables no value was given for.
+type UnresolvedVariablesError struct {
+	Variables []string
+}
+
+func (e *UnresolvedVariablesError) Error() string {
+	return "Unresolved template variables: " + strings.Join(e.Variables, ", ") + "."
+}
+
+/*
+RenderTemplates replaces the placeholders in the values of kvs with variables.
+Placeholders without a variable are left as they are and their names returned,
+sorted.
+*/
+func RenderTemplates(kvs map[string]string, variables map[string]string) []string {
+	unresolved := make(map[string]bool)
+	for key, value := range kvs {
+		kvs[key] = templatePattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			name := templatePattern.FindStringSubmatch(placeholder)[1]
+			variable, found := variables[name]
+			if found == false {
+				unresolved[name] = true
+				return placeholder
+			}
+			return variable
+		})
+	}
+
+	var names []string
+	for name := range unresolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+TemplateVariables reads the variables file of the service and, when subdomain
+is set, of the subdomain, whose variables take precedence. Either file may be
+missing.
+*/
+func (kvStruct *KeyValuesStruct) TemplateVariables(token string, subdomain string) (map[string]string, error) {
+	variables := make(map[string]string)
+
+	subdomains := []string{""}
+	if subdomain != "" {
+		subdomains = append(subdomains, subdomain)
+	}
+
+	for _, s := range subdomains {
+		path, err := MountPath(token, s, TEMPLATE_VARIABLES_FILE)
+		if err != nil {
+			return variables, err
+		}
+		_, err = os.Stat(path)
+		if err != nil {
+			continue
+		}
+		err = ReadPropertiesFile(path, ConfigOptions{}, &variables)
+		if err != nil {
+			return variables, ConfigErrors{toConfigFileError(path, err)}
+		}
+	}
+	return variables, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	kvs := map[string]string{
+		"url":    "https://<%= @HOST %>:<%=@PORT%>/aai",
+		"plain":  "value",
+		"secret": "<%= @PASSWORD %>",
+		"other":  "<%= @USER %>-<%= @PASSWORD %>",
+	}
+	variables := map[string]string{"HOST": "aai.onap", "PORT": "8443"}
+
+	unresolved := RenderTemplates(kvs, variables)
+
+	assert.Equal(t, []string{"PASSWORD", "USER"}, unresolved)
+	assert.Equal(t, map[string]string{
+		"url":    "https://aai.onap:8443/aai",
+		"plain":  "value",
+		"secret": "<%= @PASSWORD %>",
+		"other":  "<%= @USER %>-<%= @PASSWORD %>",
+	}, kvs)
+}
+
+func TestTemplateVariables(t *testing.T) {
+	oldMOUNTPATH := MOUNTPATH
+	dir := writeConfigFiles(map[string]string{
+		"token1/.variables":      "HOST=aai.onap\nPORT=8443\n",
+		"token1/sub1/.variables": "PORT=9443\n",
+		"token1/sub2/a.yaml":     "a: 1\n",
+		"token2/.variables":      "HOST=\\u12\n",
+	})
+	MOUNTPATH = dir + "/"
+	defer func() {
+		os.RemoveAll(dir)
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	kv := &KeyValuesStruct{}
+
+	variables, err := kv.TemplateVariables("token1", "sub1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"HOST": "aai.onap", "PORT": "9443"}, variables)
+
+	variables, err = kv.TemplateVariables("token1", "sub2")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"HOST": "aai.onap", "PORT": "8443"}, variables)
+
+	variables, err = kv.TemplateVariables("token3", "")
+	assert.Nil(t, err)
+	assert.Empty(t, variables)
+
+	_, err = kv.TemplateVariables("token2", "")
+	_, ok := err.(ConfigErrors)
+	assert.True(t, ok, "ConfigErrors is expected")
+
+	kvs, err := kv.ConfigReader("token1", "sub2", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, kvs)
+	kvs, err = kv.ConfigReader("token1", "", "", ConfigOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, kvs, "Variables files are not loaded as config.")
+}
+
+// Loads token1 with body into an in-memory datastore and returns the response.
+func loadTemplatedConfig(body LoadConfigBody) (*httptest.ResponseRecorder, DatastoreConnector) {
+	oldDatastore := Datastore
+	oldKeyValues := KeyValues
+	oldMOUNTPATH := MOUNTPATH
+
+	dir := writeConfigFiles(map[string]string{
+		"token1/.variables":   "HOST=aai.onap\n",
+		"token1/a.properties": "url=https://<%= @HOST %>:<%= @PORT %>\n",
+	})
+	Datastore = &MemoryStruct{}
+	Datastore.InitializeDatastoreClient()
+	KeyValues = &KeyValuesStruct{}
+	MOUNTPATH = dir + "/"
+	datastore := Datastore
+
+	defer func() {
+		os.RemoveAll(dir)
+		Datastore = oldDatastore
+		KeyValues = oldKeyValues
+		MOUNTPATH = oldMOUNTPATH
+	}()
+
+	b, _ := json.Marshal(body)
+
+	request, _ := http.NewRequest("POST", "/v1/config/load", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterConfig().ServeHTTP(response, request)
+	return response, datastore
+}
+
+func TestHandleConfigPOST_templates(t *testing.T) {
+	response, datastore := loadTemplatedConfig(LoadConfigBody{
+		Token:     "token1",
+		Variables: map[string]string{"PORT": "8443"},
+	})
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	value, _, _ := datastore.RequestGET("token1/", "url")
+	assert.Equal(t, "https://aai.onap:8443", value)
+}
+
+func TestHandleConfigPOST_unresolved(t *testing.T) {
+	response, datastore := loadTemplatedConfig(LoadConfigBody{Token: "token1"})
+
+	assert.Equal(t, 422, response.Code, "422 response is expected")
+	var resp ResponseUnresolvedVariablesStruct
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, []string{"PORT"}, resp.Unresolved)
+	assert.NotContains(t, listAllKeys(t, datastore), "token1/url", "Nothing is loaded.")
+
+	response, datastore = loadTemplatedConfig(LoadConfigBody{Token: "token1", AllowUnresolved: true})
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	assert.Contains(t, response.Body.String(), "PORT")
+	value, _, _ := datastore.RequestGET("token1/", "url")
+	assert.Equal(t, "https://aai.onap:<%= @PORT %>", value)
+}
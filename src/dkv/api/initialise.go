@@ -26,6 +26,7 @@ var (
 	Datastore DatastoreConnector
 	KeyValues KeyValuesInterface
 	Directory DirectoryOperationer
+	Registry  ServiceRegistry
 )
 
 func Initialise() error {
@@ -33,22 +34,17 @@ func Initialise() error {
 		return errors.New("DATASTORE environment variable not set.")
 	}
 
-	if os.Getenv("DATASTORE") == "consul" {
-		Datastore = &ConsulStruct{}
-	} else if os.Getenv("DATASTORE") == "cassandra" {
-		Datastore = &CassandraStruct{}
-	} else {
-		return errors.New("Unrecognised Datastore. Supports only consul or cassandra")
+	datastore, err := NewDatastore(os.Getenv("DATASTORE"))
+	if err != nil {
+		return err
 	}
+	Datastore = datastore
 
-	jsonExists, err := JsonChecker(JSONPATH)
-	if jsonExists == false {
-		log.Println("[INFO] token_service_map.json not found. Creating.")
-		err = JsonCreate(JSONPATH)
-		if err != nil {
-			return err
-		}
+	registry, err := NewRegistry(os.Getenv("REGISTRY"))
+	if err != nil {
+		return err
 	}
+	Registry = registry
 
 	KeyValues = &KeyValuesStruct{}
 	Directory = &DirectoryStruct{directory: ""}
@@ -63,6 +59,16 @@ func Initialise() error {
 		return err
 	}
 
+	err = Registry.InitialiseRegistry()
+	if err != nil {
+		return err
+	}
+
+	AdminSecret = os.Getenv("ADMIN_SECRET")
+	if AdminSecret == "" {
+		log.Println("[WARN] ADMIN_SECRET not set. Admin routes will reject every request.")
+	}
+
 	if os.Getenv("MOUNTPATH") != "" {
 		MOUNTPATH = os.Getenv("MOUNTPATH")
 	} else {
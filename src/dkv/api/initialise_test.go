@@ -51,27 +51,85 @@ func TestInitialise_consul(t *testing.T) {
 }
 
 func TestInitialise_cassandra(t *testing.T) {
-	oldDatastore_ip := os.Getenv("DATASTORE_IP")
 	oldDatastore_type := os.Getenv("DATASTORE")
 	oldMOUNTPATH := os.Getenv("MOUNTPATH")
-	oldJsonChecker := JsonChecker
 
-	os.Setenv("DATASTORE_IP", "localhost")
+	_, cleanup := startFakeMUSIC()
 	os.Setenv("DATASTORE", "cassandra")
 
 	defer func() {
-		os.Setenv("DATASTORE_IP", oldDatastore_ip)
+		cleanup()
 		os.Setenv("DATASTORE", oldDatastore_type)
 		os.Setenv("MOUNTPATH", oldMOUNTPATH)
+	}()
+
+	err := Initialise()
+	assert.Nil(t, err)
+}
+
+func TestInitialise_embedded(t *testing.T) {
+	oldDatastore_type := os.Getenv("DATASTORE")
+	oldMOUNTPATH := os.Getenv("MOUNTPATH")
+
+	cleanup := setupEmbeddedDir()
+	os.Setenv("DATASTORE", "embedded")
+
+	defer func() {
+		cleanup()
+		os.Setenv("DATASTORE", oldDatastore_type)
+		os.Setenv("MOUNTPATH", oldMOUNTPATH)
+	}()
+
+	err := Initialise()
+	assert.Nil(t, err)
+	Datastore.(*EmbeddedStruct).db.Close()
+}
+
+func TestInitialise_fileRegistry(t *testing.T) {
+	oldDatastore_type := os.Getenv("DATASTORE")
+	oldRegistry := os.Getenv("REGISTRY")
+	oldJsonChecker := JsonChecker
+	oldJsonCreate := JsonCreate
+
+	os.Setenv("DATASTORE", "memory")
+	os.Setenv("REGISTRY", "file")
+
+	defer func() {
+		os.Setenv("DATASTORE", oldDatastore_type)
+		os.Setenv("REGISTRY", oldRegistry)
 		JsonChecker = oldJsonChecker
+		JsonCreate = oldJsonCreate
 	}()
 
+	created := false
 	JsonChecker = func(path string) (bool, error) {
-		return true, nil
+		return false, nil
+	}
+	JsonCreate = func(path string) error {
+		created = true
+		return nil
 	}
 
 	err := Initialise()
 	assert.Nil(t, err)
+	assert.IsType(t, &JSONRegistryStruct{}, Registry)
+	assert.True(t, created, "token_service_map.json should be created.")
+}
+
+func TestInitialise_registryUnknown(t *testing.T) {
+	oldDatastore_type := os.Getenv("DATASTORE")
+	oldRegistry := os.Getenv("REGISTRY")
+
+	os.Setenv("DATASTORE", "memory")
+	os.Setenv("REGISTRY", "test")
+
+	defer func() {
+		os.Setenv("DATASTORE", oldDatastore_type)
+		os.Setenv("REGISTRY", oldRegistry)
+	}()
+
+	err := Initialise()
+	assert.NotNil(t, err)
 }
 
 func TestInitialise_datastoreUnknown(t *testing.T) {
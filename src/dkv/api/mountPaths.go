@@ -0,0 +1,132 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+Tokens, subdomains and filenames become names in MOUNTPATH. Each may only hold
+letters, digits, '.', '_' and '-', and may not be "." or "..", so that none of
+them can step out of its directory. Subdomains do not nest: their keys are
+written under token/subdomain/, and the routes take a subdomain as one segment.
+*/
+var pathNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func validPathName(name string) bool {
+	return pathNamePattern.MatchString(name) && name != "." && name != ".."
+}
+
+func ValidateToken(token string) error {
+	if validPathName(token) == false {
+		return InvalidError("Invalid token.")
+	}
+	return nil
+}
+
+func ValidateSubdomain(subdomain string) error {
+	if validPathName(subdomain) == false {
+		return InvalidError("Invalid subdomain.")
+	}
+	return nil
+}
+
+func ValidateFilename(filename string) error {
+	if validPathName(filename) == false {
+		return InvalidError("Invalid filename.")
+	}
+	return nil
+}
+
+// ValidatePathNames validates token and, when set, subdomain and filename.
+func ValidatePathNames(token string, subdomain string, filename string) error {
+	err := ValidateToken(token)
+	if err == nil && subdomain != "" {
+		err = ValidateSubdomain(subdomain)
+	}
+	if err == nil && filename != "" {
+		err = ValidateFilename(filename)
+	}
+	return err
+}
+
+/*
+MountPath returns the path of the directory of token, of its subdomain, or of
+a file in either, inside MOUNTPATH. subdomain and filename may be empty. See
+ConfinePath for what is checked of the result.
+*/
+func MountPath(token string, subdomain string, filename string) (string, error) {
+	err := ValidatePathNames(token, subdomain, filename)
+	if err != nil {
+		return "", err
+	}
+	return ConfinePath(filepath.Join(MOUNTPATH, token, subdomain, filename))
+}
+
+/*
+ConfinePath returns path if, with every symlink in it followed, it lies inside
+MOUNTPATH. Parts of path that do not exist yet are taken as they are, so it may
+name a file that is about to be created.
+*/
+func ConfinePath(path string) (string, error) {
+	root, err := resolvePath(MOUNTPATH)
+	if err != nil {
+		return "", InternalError(err)
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", FilesystemError(err, "Path")
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ForbiddenError("Path is outside of the mount.")
+	}
+	return path, nil
+}
+
+// Follows the symlinks of the longest existing part of path.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if os.IsNotExist(err) == false {
+			return "", err
+		}
+		// A dangling symlink, which writes would follow wherever it points.
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", ForbiddenError("Path is outside of the mount.")
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018 Intel Corporation, Inc
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePathNames(t *testing.T) {
+	assert.Nil(t, ValidatePathNames("default", "", ""))
+	assert.Nil(t, ValidatePathNames("5b1f3e0c-7c1e-4a45-9f3b-0f0d3c1c1a1a", "sub_1", ".variables"))
+
+	assert.NotNil(t, ValidatePathNames("", "", ""))
+	assert.NotNil(t, ValidatePathNames("..", "", ""))
+	assert.NotNil(t, ValidatePathNames("a/b", "", ""))
+	assert.NotNil(t, ValidatePathNames("token1", "../..", ""))
+	assert.NotNil(t, ValidatePathNames("token1", "sub_1/nested", ""), "Subdomains do not nest.")
+	assert.NotNil(t, ValidatePathNames("token1", "sub1/../..", ""))
+	assert.NotNil(t, ValidatePathNames("token1", "/etc", ""))
+	assert.NotNil(t, ValidatePathNames("token1", "sub1/", ""))
+	assert.NotNil(t, ValidatePathNames("token1", "", "../passwd"))
+	assert.NotNil(t, ValidatePathNames("token1", "", "a\\b"))
+}
+
+func TestMountPath(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	outside, _ := ioutil.TempDir("", "dkv-outside")
+	defer os.RemoveAll(outside)
+
+	os.MkdirAll(MOUNTPATH+"token1/sub1", 0770)
+	os.Symlink(outside, MOUNTPATH+"token1/escape")
+	os.Symlink(filepath.Join(outside, "missing"), MOUNTPATH+"token1/dangling")
+	os.Symlink(MOUNTPATH+"token1/sub1", MOUNTPATH+"token1/inside")
+
+	path, err := MountPath("token1", "sub1", "new.properties")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(MOUNTPATH, "token1/sub1/new.properties"), path)
+
+	_, err = MountPath("token1", "inside", "a.properties")
+	assert.Nil(t, err, "Symlinks inside the mount are followed.")
+
+	_, err = MountPath("token1", "escape", "")
+	assert.Equal(t, "Path is outside of the mount.", err.Error())
+
+	_, err = MountPath("token1", "escape", "a.properties")
+	assert.Equal(t, "Path is outside of the mount.", err.Error())
+
+	_, err = MountPath("token1", "", "dangling")
+	assert.Equal(t, "Path is outside of the mount.", err.Error())
+
+	_, err = MountPath("token1", "../..", "")
+	assert.Equal(t, "Invalid subdomain.", err.Error())
+}
+
+func TestDirectoryStruct_traversal(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	outside, _ := ioutil.TempDir("", "dkv-outside")
+	defer os.RemoveAll(outside)
+	ioutil.WriteFile(filepath.Join(outside, "keep.properties"), []byte("a=1\n"), 0660)
+
+	os.MkdirAll(MOUNTPATH+"token1", 0770)
+	os.Symlink(outside, MOUNTPATH+"token1/escape")
+
+	d := &DirectoryStruct{}
+
+	assert.NotNil(t, d.RemoveSubDirectory("token1", "../.."))
+	assert.NotNil(t, d.RemoveSubDirectory("token1", "escape"))
+	assert.NotNil(t, d.RemoveFile("token1", "escape", "keep.properties"))
+	_, err := d.CreateFile("token1", "escape", "new.properties")
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(filepath.Join(outside, "keep.properties"))
+	assert.Nil(t, err, "Nothing outside of the mount is removed.")
+	_, err = os.Stat(filepath.Join(outside, "new.properties"))
+	assert.True(t, os.IsNotExist(err), "Nothing outside of the mount is created.")
+
+	kvs, err := (&KeyValuesStruct{}).ConfigReader("token1", "", "", ConfigOptions{})
+	assert.Empty(t, kvs, "Files behind symlinks out of the mount are not read.")
+	_, ok := err.(ConfigErrors)
+	assert.True(t, ok, "ConfigErrors is expected")
+}
@@ -17,9 +17,12 @@
 package api
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"github.com/gorilla/mux"
 	"net/http"
+	"path"
+	"regexp"
+	"strconv"
 )
 
 type ResponseStringStruct struct {
@@ -32,55 +35,242 @@ type ResponseGETStruct struct {
 
 type ResponseGETSStruct struct {
 	Response []string `json:"response"`
+	Cursor   string   `json:"cursor,omitempty"`
 }
 
+type ResponseKeyValuesStruct struct {
+	Response []KeyValue `json:"response"`
+	Cursor   string     `json:"cursor,omitempty"`
+}
+
+type ResponseEffectiveConfigStruct struct {
+	Response map[string]EffectiveValue `json:"response"`
+}
+
+// HandleGET falls back from the subdomain to the service and then to default, see ResolveKey.
 func HandleGET(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
-	value, err := Datastore.RequestGET(vars["token"], key)
+	err := ValidatePathNames(vars["token"], vars["subdomain"], "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, vars["token"], ROLE_READ_ONLY) {
+		return
+	}
+
+	effective, found, err := ResolveKey(vars["token"], vars["subdomain"], key)
 
 	if err != nil {
-		req := ResponseStringStruct{Response: string(err.Error())}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(req)
+		GenerateErrorResponse(w, r, DatastoreError(err))
+	} else if found == false {
+		GenerateErrorResponse(w, r, NotFoundError("Key "+key+" not found."))
 	} else {
-		req := ResponseGETStruct{Response: map[string]string{key: value}}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(req)
+		GenerateResult(w, r, ResponseGETStruct{Response: map[string]string{key: effective.Value}},
+			http.StatusOK, KeyResult{Key: key, Value: effective.Value, Layer: effective.Layer})
 	}
 }
 
+// HandleEffectiveConfigGet returns the merged config of a service or subdomain, see ResolveConfig.
+func HandleEffectiveConfigGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	err := ValidatePathNames(vars["token"], vars["subdomain"], "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, vars["token"], ROLE_READ_ONLY) {
+		return
+	}
+
+	effective, err := ResolveConfig(vars["token"], vars["subdomain"])
+
+	if err != nil {
+		GenerateErrorResponse(w, r, DatastoreError(err))
+	} else {
+		GenerateResult(w, r, ResponseEffectiveConfigStruct{Response: effective},
+			http.StatusOK, EffectiveConfigResult{Config: effective})
+	}
+}
+
+/*
+listOptions reads the paging and filters of a listing request: limit, the
+cursor of the previous page, and a glob and a regex keys must match.
+*/
+func listOptions(r *http.Request, recursive bool) (ListOptions, error) {
+	query := r.URL.Query()
+	options := ListOptions{Recursive: recursive}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return options, InvalidError("Invalid limit.")
+		}
+		options.Limit = n
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return options, InvalidError("Invalid cursor.")
+		}
+		options.After = string(after)
+	}
+
+	glob := query.Get("glob")
+	if _, err := path.Match(glob, ""); err != nil {
+		return options, InvalidError("Malformed glob " + glob + ".")
+	}
+	var re *regexp.Regexp
+	if pattern := query.Get("regex"); pattern != "" {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return options, InvalidError("Malformed regex " + pattern + ".")
+		}
+	}
+	if glob != "" || re != nil {
+		options.Match = func(key string) bool {
+			if glob != "" {
+				if matched, _ := path.Match(glob, key); matched == false {
+					return false
+				}
+			}
+			return re == nil || re.MatchString(key)
+		}
+	}
+	return options, nil
+}
+
+// listCursor is the cursor of the page after kvs, empty when there is none.
+func listCursor(kvs []KeyValue, more bool) string {
+	if more == false || len(kvs) == 0 {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(kvs[len(kvs)-1].Key))
+}
+
 func HandleGETS(w http.ResponseWriter, r *http.Request) {
+	if !Authorise(w, r, "", ROLE_ADMIN) {
+		return
+	}
 
-	values, err := Datastore.RequestGETS()
+	options, err := listOptions(r, true)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	kvs, more, err := Datastore.RequestLIST("", options)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, DatastoreError(err))
+		return
+	}
+
+	keys := []string{}
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	cursor := listCursor(kvs, more)
+
+	v1Keys := keys
+	if len(keys) == 0 {
+		// v1 has always answered an empty listing this way.
+		v1Keys = []string{"No keys found."}
+	}
+	GenerateResult(w, r, ResponseGETSStruct{Response: v1Keys, Cursor: cursor},
+		http.StatusOK, KeyListResult{Keys: keys, Cursor: cursor})
+}
+
+/*
+HandleServiceGETS lists the keys of a service, or of one of its subdomains, and
+their values. Keys of subdomains below are only listed with ?recursive=true. See
+listOptions for paging and filtering.
+*/
+func HandleServiceGETS(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+	subdomain := vars["subdomain"]
+
+	err := ValidatePathNames(token, subdomain, "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_READ_ONLY) {
+		return
+	}
 
+	options, err := listOptions(r, r.URL.Query().Get("recursive") == "true")
 	if err != nil {
-		req := ResponseStringStruct{Response: string(err.Error())}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(req)
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	kvs, more, err := Datastore.RequestLIST(datastorePrefix(token, subdomain), options)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, DatastoreError(err))
 	} else {
-		req := ResponseGETSStruct{Response: values}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(req)
+		cursor := listCursor(kvs, more)
+		GenerateResult(w, r, ResponseKeyValuesStruct{Response: kvs, Cursor: cursor},
+			http.StatusOK, KeyValueListResult{KeyValues: kvs, Cursor: cursor})
 	}
 }
 
+/*
+HandleDELETE deletes a key of a service, or of one of its subdomains, under the
+prefix loading configs wrote it to. Keys of other layers are not touched. With
+?reflect=true the key is also removed from MANAGED_CONFIG_FILE, see writeKeys.
+*/
 func HandleDELETE(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	token := vars["token"]
+	subdomain := vars["subdomain"]
+	key := vars["key"]
+
+	err := ValidatePathNames(token, subdomain, "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_WRITER) {
+		return
+	}
+
+	prefix := datastorePrefix(token, subdomain)
+	_, found, err := Datastore.RequestGET(prefix, key)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, DatastoreError(err))
+		return
+	}
+	if found == false {
+		GenerateErrorResponse(w, r, NotFoundError("Key "+key+" not found."))
+		return
+	}
+
+	if r.URL.Query().Get("reflect") == "true" {
+		err = KeyValues.UpdateManagedFile(token, subdomain, nil, []string{key})
+		if err != nil {
+			generateConfigReadError(w, r, err)
+			return
+		}
+	}
 
-	err := Datastore.RequestDELETE(vars["token"], vars["key"])
+	err = Datastore.RequestDELETE(prefix, key)
 
 	if err != nil {
-		req := ResponseStringStruct{Response: string(err.Error())}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(req)
+		GenerateErrorResponse(w, r, DatastoreError(err))
 	} else {
-		req := ResponseStringStruct{Response: "Key deletion successful."}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&req)
+		GenerateResult(w, r, ResponseStringStruct{Response: "Key deletion successful."}, http.StatusNoContent, nil)
 	}
 }
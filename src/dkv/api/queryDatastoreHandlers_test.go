@@ -17,17 +17,29 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func RouterConsul() *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/v1/getconfig/{key}", HandleGET).Methods("GET")
-	router.HandleFunc("/v1/deleteconfig/{key}", HandleDELETE).Methods("DELETE")
+	router.Use(asPrincipal(AdminPrincipal))
+	router.HandleFunc("/v1/getconfig/{token}/{key}", HandleGET).Methods("GET")
+	router.HandleFunc("/v1/getconfig/{token}/{subdomain}/{key}", HandleGET).Methods("GET")
+	router.HandleFunc("/v1/effectiveconfig/{token}", HandleEffectiveConfigGet).Methods("GET")
+	router.HandleFunc("/v1/effectiveconfig/{token}/{subdomain}", HandleEffectiveConfigGet).Methods("GET")
+	router.HandleFunc("/v1/getconfigs/{token}", HandleServiceGETS).Methods("GET")
+	router.HandleFunc("/v1/getconfigs/{token}/{subdomain}", HandleServiceGETS).Methods("GET")
+	router.HandleFunc("/v1/deleteconfig/{token}/{key}", HandleDELETE).Methods("DELETE")
+	router.HandleFunc("/v1/deleteconfig/{token}/{subdomain}/{key}", HandleDELETE).Methods("DELETE")
 	router.HandleFunc("/v1/getconfigs", HandleGETS).Methods("GET")
 	return router
 }
@@ -53,7 +65,7 @@ func TestHandleGETS_err(t *testing.T) {
 	response := httptest.NewRecorder()
 	RouterConsul().ServeHTTP(response, request)
 
-	assert.Equal(t, 400, response.Code, "400 response is expected")
+	assert.Equal(t, 503, response.Code, "503 response is expected")
 }
 
 func TestHandleGET(t *testing.T) {
@@ -61,7 +73,7 @@ func TestHandleGET(t *testing.T) {
 	Datastore = &FakeConsul{}
 	defer func() { Datastore = oldDataStore }()
 
-	request, _ := http.NewRequest("GET", "/v1/getconfig/key1", nil)
+	request, _ := http.NewRequest("GET", "/v1/getconfig/token1/key1", nil)
 	response := httptest.NewRecorder()
 	RouterConsul().ServeHTTP(response, request)
 
@@ -73,11 +85,11 @@ func TestHandleGET_err(t *testing.T) {
 	Datastore = &FakeConsulErr{}
 	defer func() { Datastore = oldDataStore }()
 
-	request, _ := http.NewRequest("GET", "/v1/getconfig/key1", nil)
+	request, _ := http.NewRequest("GET", "/v1/getconfig/token1/key1", nil)
 	response := httptest.NewRecorder()
 	RouterConsul().ServeHTTP(response, request)
 
-	assert.Equal(t, 400, response.Code, "400 response is expected")
+	assert.Equal(t, 503, response.Code, "503 response is expected")
 }
 
 func TestHandleDELETE(t *testing.T) {
@@ -85,7 +97,7 @@ func TestHandleDELETE(t *testing.T) {
 	Datastore = &FakeConsul{}
 	defer func() { Datastore = oldDataStore }()
 
-	request, _ := http.NewRequest("DELETE", "/v1/deleteconfig/key1", nil)
+	request, _ := http.NewRequest("DELETE", "/v1/deleteconfig/token1/key1", nil)
 	response := httptest.NewRecorder()
 	RouterConsul().ServeHTTP(response, request)
 
@@ -97,9 +109,346 @@ func TestHandleDELETE_err(t *testing.T) {
 	Datastore = &FakeConsulErr{}
 	defer func() { Datastore = oldDataStore }()
 
-	request, _ := http.NewRequest("DELETE", "/v1/deleteconfig/key1", nil)
+	request, _ := http.NewRequest("DELETE", "/v1/deleteconfig/token1/key1", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 503, response.Code, "503 response is expected")
+}
+
+func TestHandleGET_memory(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	Datastore.RequestPUT("token1/", "key1", "value1")
+
+	request, _ := http.NewRequest("GET", "/v1/getconfig/token1/key1", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	assert.JSONEq(t, `{"response": {"key1": "value1"}}`, response.Body.String())
+}
+
+func TestHandleDELETE_memory(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	Datastore.RequestPUT("token1/", "key1", "value1")
+	Datastore.RequestPUT("token1/subdomain1/", "key1", "value2")
+
+	request, _ := http.NewRequest("DELETE", "/v1/deleteconfig/token1/subdomain1/key1", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	_, found, _ := Datastore.RequestGET("token1/subdomain1/", "key1")
+	assert.False(t, found)
+	_, found, _ = Datastore.RequestGET("token1/", "key1")
+	assert.True(t, found, "The key of the service is not touched.")
+
+	request, _ = http.NewRequest("DELETE", "/v1/deleteconfig/token1/subdomain1/key1", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 404, response.Code, "404 response is expected")
+
+	request, _ = http.NewRequest("DELETE", "/v1/deleteconfig/token$1/key1", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 400, response.Code, "400 response is expected")
+}
+
+func TestHandleGET_inheritance(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	Datastore.RequestPUT("default/", "key1", "default1")
+	Datastore.RequestPUT("default/", "key2", "default2")
+	Datastore.RequestPUT("default/", "key3", "default3")
+	Datastore.RequestPUT("token1/", "key2", "service2")
+	Datastore.RequestPUT("token1/", "key3", "service3")
+	Datastore.RequestPUT("token1/subdomain1/", "key3", "subdomain3")
+	Datastore.RequestPUT("token1/subdomain1/", "key2", "")
+
+	get := func(path string) string {
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		RouterConsul().ServeHTTP(response, request)
+		assert.Equal(t, 200, response.Code, "200 response is expected")
+		return response.Body.String()
+	}
+
+	assert.JSONEq(t, `{"response": {"key1": "default1"}}`, get("/v1/getconfig/token1/subdomain1/key1"))
+	assert.JSONEq(t, `{"response": {"key2": ""}}`, get("/v1/getconfig/token1/subdomain1/key2"),
+		"An empty value is found and not fallen back from.")
+	assert.JSONEq(t, `{"response": {"key2": "service2"}}`, get("/v1/getconfig/token1/key2"))
+	assert.JSONEq(t, `{"response": {"key3": "subdomain3"}}`, get("/v1/getconfig/token1/subdomain1/key3"))
+	assert.JSONEq(t, `{"response": {"key3": "service3"}}`, get("/v1/getconfig/token1/key3"))
+	assert.JSONEq(t, `{"response": {"key3": "default3"}}`, get("/v1/getconfig/token2/key3"))
+
+	request, _ := http.NewRequest("GET", "/v1/getconfig/token1/subdomain1/key4", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 404, response.Code, "404 response is expected")
+	assert.JSONEq(t, `{"response": "Key key4 not found.", "error": {"code": "not_found"}}`, response.Body.String())
+}
+
+func TestHandleEffectiveConfigGet(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	Datastore.RequestPUT("default/", "key1", "default1")
+	Datastore.RequestPUT("default/", "key2", "default2")
+	Datastore.RequestPUT("token1/", "key2", "service2")
+	Datastore.RequestPUT("token1/", "key3", "service3")
+	Datastore.RequestPUT("token1/subdomain1/", "key3", "subdomain3")
+	Datastore.RequestPUT("token10/", "key4", "other4")
+	// Left behind by a subdomain whose directory was removed.
+	Datastore.RequestPUT("token1/removed/", "key5", "removed5")
+
+	request, _ := http.NewRequest("GET", "/v1/effectiveconfig/token1/subdomain1", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	assert.JSONEq(t, `{"response": {
+		"key1": {"value": "default1", "layer": "default"},
+		"key2": {"value": "service2", "layer": "service"},
+		"key3": {"value": "subdomain3", "layer": "subdomain"}
+	}}`, response.Body.String())
+
+	request, _ = http.NewRequest("GET", "/v1/effectiveconfig/token1", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	assert.JSONEq(t, `{"response": {
+		"key1": {"value": "default1", "layer": "default"},
+		"key2": {"value": "service2", "layer": "service"},
+		"key3": {"value": "service3", "layer": "service"}
+	}}`, response.Body.String(), "Keys of subdomains are not part of the service.")
+}
+
+func TestHandleEffectiveConfigGet_err(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = &FakeConsulErr{}
+	defer func() { Datastore = oldDataStore }()
+
+	request, _ := http.NewRequest("GET", "/v1/effectiveconfig/token1", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 503, response.Code, "503 response is expected")
+}
+
+func TestHandleServiceGETS(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	Datastore.RequestPUT("token1/", "key1", "value1")
+	Datastore.RequestPUT("token1/subdomain1/", "key2", "value2")
+	Datastore.RequestPUT("token10/", "key3", "value3")
+	Datastore.RequestPUT("default/", "key4", "value4")
+
+	request, _ := http.NewRequest("GET", "/v1/getconfigs/token1", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	assert.JSONEq(t, `{"response": [{"key": "key1", "value": "value1"}]}`, response.Body.String(),
+		"Only the keys of token1 are listed.")
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs/token1?recursive=true", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.JSONEq(t, `{"response": [{"key": "key1", "value": "value1"}, {"key": "subdomain1/key2", "value": "value2"}]}`,
+		response.Body.String())
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs/token1/subdomain1", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.JSONEq(t, `{"response": [{"key": "key2", "value": "value2"}]}`, response.Body.String())
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs/token2", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	assert.JSONEq(t, `{"response": []}`, response.Body.String())
+}
+
+func TestHandleServiceGETS_err(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = &FakeConsulErr{}
+	defer func() { Datastore = oldDataStore }()
+
+	request, _ := http.NewRequest("GET", "/v1/getconfigs/token1", nil)
 	response := httptest.NewRecorder()
 	RouterConsul().ServeHTTP(response, request)
 
+	assert.Equal(t, 503, response.Code, "503 response is expected")
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs/token$1", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
 	assert.Equal(t, 400, response.Code, "400 response is expected")
 }
+
+func TestHandleServiceGETS_pages(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	Datastore.RequestPUT("token1/", "aai.url", "value1")
+	Datastore.RequestPUT("token1/", "aai.user", "value2")
+	Datastore.RequestPUT("token1/", "sdc.url", "value3")
+
+	var keys []string
+	url := "/v1/getconfigs/token1?limit=2"
+	for url != "" {
+		request, _ := http.NewRequest("GET", url, nil)
+		response := httptest.NewRecorder()
+		RouterConsul().ServeHTTP(response, request)
+		assert.Equal(t, 200, response.Code, "200 response is expected")
+
+		var page ResponseKeyValuesStruct
+		json.Unmarshal(response.Body.Bytes(), &page)
+		assert.True(t, len(page.Response) <= 2)
+		for _, kv := range page.Response {
+			keys = append(keys, kv.Key)
+		}
+
+		url = ""
+		if page.Cursor != "" {
+			url = "/v1/getconfigs/token1?limit=2&cursor=" + page.Cursor
+		}
+	}
+	assert.Equal(t, []string{"aai.url", "aai.user", "sdc.url"}, keys)
+
+	request, _ := http.NewRequest("GET", "/v1/getconfigs/token1?glob=*.url", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+	assert.JSONEq(t, `{"response": [{"key": "aai.url", "value": "value1"}, {"key": "sdc.url", "value": "value3"}]}`,
+		response.Body.String())
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs/token1?glob=aai.*&regex=user$", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+	assert.JSONEq(t, `{"response": [{"key": "aai.user", "value": "value2"}]}`, response.Body.String())
+
+	for _, query := range []string{"limit=0", "limit=a", "cursor=%25", "glob=[", "regex=("} {
+		request, _ = http.NewRequest("GET", "/v1/getconfigs/token1?"+query, nil)
+		response = httptest.NewRecorder()
+		RouterConsul().ServeHTTP(response, request)
+		assert.Equal(t, 400, response.Code, "400 response is expected for "+query)
+	}
+}
+
+func TestHandleGETS_pages(t *testing.T) {
+	oldDataStore := Datastore
+	Datastore = newTestDatastore("memory")
+	Datastore.InitializeDatastoreClient()
+	defer func() { Datastore = oldDataStore }()
+
+	request, _ := http.NewRequest("GET", "/v1/getconfigs", nil)
+	response := httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+	assert.JSONEq(t, `{"response": ["No keys found."]}`, response.Body.String())
+
+	Datastore.RequestPUT("token1/", "key1", "value1")
+	Datastore.RequestPUT("token2/", "key2", "value2")
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs?limit=1", nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+
+	var page ResponseGETSStruct
+	json.Unmarshal(response.Body.Bytes(), &page)
+	assert.Equal(t, []string{"token1/key1"}, page.Response)
+	assert.NotEmpty(t, page.Cursor)
+
+	request, _ = http.NewRequest("GET", "/v1/getconfigs?limit=1&cursor="+page.Cursor, nil)
+	response = httptest.NewRecorder()
+	RouterConsul().ServeHTTP(response, request)
+	assert.JSONEq(t, `{"response": ["token2/key2"]}`, response.Body.String())
+}
+
+// Keys loaded from config files are read and deleted at the address they were loaded to.
+func TestQueryRoutes_loadRoundTrip(t *testing.T) {
+	cleanup := setupMountpath()
+	defer cleanup()
+
+	oldKeyValues := KeyValues
+	oldDirectory := Directory
+	KeyValues = &KeyValuesStruct{}
+	Directory = &DirectoryStruct{}
+	defer func() {
+		KeyValues = oldKeyValues
+		Directory = oldDirectory
+	}()
+
+	files := map[string]string{
+		"default/default.properties": "aai.port=8443\naai.url=http://default\n",
+		"token1/service.properties":  "aai.url=http://service\naai.user=service\n",
+		"token1/sub1/sub.properties": "aai.url=http://sub1\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(MOUNTPATH+name), 0770)
+		ioutil.WriteFile(MOUNTPATH+name, []byte(content), 0660)
+	}
+
+	router := RouterConsul()
+	router.HandleFunc("/v1/config/load", HandleConfigLoad).Methods("POST")
+	router.HandleFunc("/v1/config/load-default", HandleDefaultConfigLoad).Methods("GET")
+
+	do := func(method string, url string, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	assert.Equal(t, 200, do("GET", "/v1/config/load-default", "").Code)
+	assert.Equal(t, 200, do("POST", "/v1/config/load", `{"token": "token1", "filename": "service.properties"}`).Code)
+	assert.Equal(t, 200, do("POST", "/v1/config/load", `{"token": "token1", "subdomain": "sub1"}`).Code)
+
+	get := func(url string) string {
+		response := do("GET", url, "")
+		assert.Equal(t, 200, response.Code, "200 response is expected for "+url)
+		return response.Body.String()
+	}
+	assert.JSONEq(t, `{"response": {"aai.url": "http://sub1"}}`, get("/v1/getconfig/token1/sub1/aai.url"))
+	assert.JSONEq(t, `{"response": {"aai.user": "service"}}`, get("/v1/getconfig/token1/sub1/aai.user"))
+	assert.JSONEq(t, `{"response": {"aai.url": "http://service"}}`, get("/v1/getconfig/token1/aai.url"))
+	assert.JSONEq(t, `{"response": {"aai.port": "8443"}}`, get("/v1/getconfig/token1/aai.port"))
+	assert.JSONEq(t, `{"response": {"aai.url": "http://default"}}`, get("/v1/getconfig/default/aai.url"))
+
+	// Deleting the key of the subdomain uncovers the one of the service.
+	assert.Equal(t, 200, do("DELETE", "/v1/deleteconfig/token1/sub1/aai.url", "").Code)
+	assert.JSONEq(t, `{"response": {"aai.url": "http://service"}}`, get("/v1/getconfig/token1/sub1/aai.url"))
+
+	assert.Equal(t, 200, do("DELETE", "/v1/deleteconfig/token1/aai.url", "").Code)
+	assert.JSONEq(t, `{"response": {"aai.url": "http://default"}}`, get("/v1/getconfig/token1/sub1/aai.url"))
+
+	// Keys of default are not deleted through a service.
+	assert.Equal(t, 404, do("DELETE", "/v1/deleteconfig/token1/aai.port", "").Code)
+
+	assert.Equal(t, 200, do("DELETE", "/v1/deleteconfig/default/aai.url", "").Code)
+	assert.Equal(t, 404, do("GET", "/v1/getconfig/token1/sub1/aai.url", "").Code)
+}
@@ -18,7 +18,6 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
 	"github.com/gorilla/mux"
 	"net/http"
 )
@@ -31,21 +30,39 @@ type CreateServiceSubdomainBody struct {
 	Subdomain string `json:"subdomain"`
 }
 
+type CreateServiceCredentialBody struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type ResponseCredentialListStruct struct {
+	Response []CredentialInfo `json:"response"`
+}
+
+type ResponseServiceListStruct struct {
+	Response []ServiceInfo `json:"response"`
+}
+
+type ResponseSubdomainListStruct struct {
+	Response []SubdomainInfo `json:"response"`
+}
+
 func ValidateCreateRegisterServiceBody(body CreateRegisterServiceBody) error {
 	if body.Domain == "" {
-		return errors.New("Domain not set. Please set domain in POST.")
+		return InvalidError("Domain not set. Please set domain in POST.")
 	}
 	if body.Domain == "default" {
-		return errors.New("Domain not allowed. Please set another domain in POST.")
+		return InvalidError("Domain not allowed. Please set another domain in POST.")
 	}
 	return nil
 }
 
-/*
-	TODO(sshank): Add validations to check if tokens/sub-domains/files indeed
-	exist in the token_service JSON or in the directory. This is to avoid the service
-	returning the file system errors to the user.
-*/
+func ValidateCreateServiceCredentialBody(body CreateServiceCredentialBody) error {
+	if body.Name == "" {
+		return InvalidError("Name not set. Please set name in POST.")
+	}
+	return ValidateRole(body.Role)
+}
 
 func HandleServiceCreate(w http.ResponseWriter, r *http.Request) {
 	var body CreateRegisterServiceBody
@@ -54,24 +71,141 @@ func HandleServiceCreate(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&body)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusBadRequest, "Empty body.")
+		GenerateErrorResponse(w, r, InvalidError("Empty body."))
 		return
 	}
 
 	err = ValidateCreateRegisterServiceBody(body)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusBadRequest, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	token, secret, err := Directory.CreateService(body)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	result := ServiceResult{Token: token, Service: body.Domain}
+	if IsV2(r) {
+		result, _, err = serviceResult(token)
+		if err != nil {
+			GenerateErrorResponse(w, r, err)
+			return
+		}
+		result.Secret = secret
+	}
+	GenerateResult(w, r,
+		ResponseStringStruct{Response: "Registration Successful. Token: " + token + " Secret: " + secret},
+		http.StatusCreated, result)
+}
+
+func HandleServiceCredentialCreate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	if !Authorise(w, r, token, ROLE_ADMIN) {
+		return
+	}
+
+	var body CreateServiceCredentialBody
+
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&body)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, InvalidError("Empty body."))
+		return
+	}
+
+	err = ValidateCreateServiceCredentialBody(body)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := Directory.SetServiceCredential(token, body.Name, body.Role)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+	} else {
+		GenerateResult(w, r,
+			ResponseStringStruct{Response: "Credential " + body.Name + " set for Token: " + token + " Secret: " + secret},
+			http.StatusCreated, CredentialResult{Token: token, Name: body.Name, Role: body.Role, Secret: secret})
+	}
+}
+
+func HandleServiceCredentialList(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	if !Authorise(w, r, token, ROLE_ADMIN) {
+		return
+	}
+
+	credentials, found, err := Directory.ListServiceCredentials(token)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+	if found == false {
+		GenerateErrorResponse(w, r, NotFoundError("Service for Token: "+token+" not found."))
+		return
+	}
+
+	if credentials == nil {
+		credentials = []CredentialInfo{}
+	}
+
+	GenerateResult(w, r, ResponseCredentialListStruct{Response: credentials},
+		http.StatusOK, CredentialListResult{Credentials: credentials})
+}
+
+func HandleServiceCredentialDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+	name := vars["name"]
+
+	if !Authorise(w, r, token, ROLE_ADMIN) {
 		return
 	}
 
-	token, err := Directory.CreateService(body)
+	err := Directory.RemoveServiceCredential(token, name)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Registration Successful. Token: "+token)
+		GenerateResult(w, r, ResponseStringStruct{Response: "Deletion of credential is successful."}, http.StatusNoContent, nil)
+	}
+}
+
+func HandleServiceList(w http.ResponseWriter, r *http.Request) {
+	if !Authorise(w, r, "", ROLE_ADMIN) {
+		return
+	}
+
+	services, err := Directory.ListServices()
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+	if services == nil {
+		services = []ServiceInfo{}
+	}
+
+	results := []ServiceResult{}
+	for _, s := range services {
+		results = append(results, ServiceResult{Token: s.Token, Service: s.Service, CreatedAt: s.CreatedAt, Subdomains: s.Subdomains})
 	}
+
+	GenerateResult(w, r, ResponseServiceListStruct{Response: services},
+		http.StatusOK, ServiceListResult{Services: results})
 }
 
 func HandleServiceGet(w http.ResponseWriter, r *http.Request) {
@@ -79,19 +213,35 @@ func HandleServiceGet(w http.ResponseWriter, r *http.Request) {
 	token := vars["token"]
 
 	if token == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "Token not present in path.")
+		GenerateErrorResponse(w, r, InvalidError("Token not present in path."))
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_READ_ONLY) {
+		return
+	}
+
+	if IsV2(r) {
+		result, found, err := serviceResult(token)
+		if err != nil {
+			GenerateErrorResponse(w, r, err)
+		} else if found == false {
+			GenerateErrorResponse(w, r, NotFoundError("Service for Token: "+token+" not found."))
+		} else {
+			GenerateResult(w, r, nil, http.StatusOK, result)
+		}
 		return
 	}
 
 	service, found, err := Directory.FindService(token)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 	} else {
 		if found == true {
 			GenerateResponse(w, r, http.StatusOK, service)
 		} else {
-			GenerateResponse(w, r, http.StatusNotFound, "Service for Token: "+token+" not found.")
+			GenerateErrorResponse(w, r, NotFoundError("Service for Token: "+token+" not found."))
 		}
 
 	}
@@ -102,16 +252,20 @@ func HandleServiceDelete(w http.ResponseWriter, r *http.Request) {
 	token := vars["token"]
 
 	if token == "default" {
-		GenerateResponse(w, r, http.StatusNotAcceptable, "Default delete not allowed.")
+		GenerateErrorResponse(w, r, ForbiddenError("Default delete not allowed."))
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_ADMIN) {
 		return
 	}
 
 	err := Directory.RemoveService(token)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Deletion of service is successful.")
+		GenerateResult(w, r, ResponseStringStruct{Response: "Deletion of service is successful."}, http.StatusNoContent, nil)
 	}
 }
 
@@ -119,33 +273,66 @@ func HandleServiceSubdomainCreate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	token := vars["token"]
 
+	if !Authorise(w, r, token, ROLE_WRITER) {
+		return
+	}
+
 	var body CreateServiceSubdomainBody
 
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&body)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusBadRequest, "Empty body.")
+		GenerateErrorResponse(w, r, InvalidError("Empty body."))
 		return
 	}
 
 	if body.Subdomain == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "Subdomain not found in POST.")
+		GenerateErrorResponse(w, r, InvalidError("Subdomain not found in POST."))
+		return
+	}
+
+	err = ValidateSubdomain(body.Subdomain)
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
 		return
 	}
 
 	err = Directory.CreateServiceSubdomain(token, body.Subdomain)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Subdomain creation success with token: "+token)
+		GenerateResult(w, r, ResponseStringStruct{Response: "Subdomain creation success with token: " + token},
+			http.StatusCreated, SubdomainResult{Token: token, Subdomain: body.Subdomain})
 	}
 
 }
 
 func HandleServiceSubdomainGet(w http.ResponseWriter, r *http.Request) {
-	// TODO(sshank): This will list all subdomain in a service.
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	if !Authorise(w, r, token, ROLE_READ_ONLY) {
+		return
+	}
+
+	subdomains, found, err := Directory.ListServiceSubdomains(token)
+
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+	if found == false {
+		GenerateErrorResponse(w, r, NotFoundError("Service for Token: "+token+" not found."))
+		return
+	}
+	if subdomains == nil {
+		subdomains = []SubdomainInfo{}
+	}
+
+	GenerateResult(w, r, ResponseSubdomainListStruct{Response: subdomains},
+		http.StatusOK, SubdomainListResult{Subdomains: subdomains})
 }
 
 func HandleServiceSubdomainDelete(w http.ResponseWriter, r *http.Request) {
@@ -154,20 +341,30 @@ func HandleServiceSubdomainDelete(w http.ResponseWriter, r *http.Request) {
 	subdomain := vars["subdomain"]
 
 	if token == "" {
-		GenerateResponse(w, r, http.StatusBadRequest, "Token not passed.")
+		GenerateErrorResponse(w, r, InvalidError("Token not passed."))
 		return
 	}
 
 	if token == "default" && subdomain == "" {
-		GenerateResponse(w, r, http.StatusNotAcceptable, "Not allowerd.")
+		GenerateErrorResponse(w, r, ForbiddenError("Not allowerd."))
+		return
+	}
+
+	err := ValidatePathNames(token, subdomain, "")
+	if err != nil {
+		GenerateErrorResponse(w, r, err)
+		return
+	}
+
+	if !Authorise(w, r, token, ROLE_WRITER) {
 		return
 	}
 
-	err := Directory.RemoveServiceSubdomain(token, subdomain)
+	err = Directory.RemoveServiceSubdomain(token, subdomain)
 
 	if err != nil {
-		GenerateResponse(w, r, http.StatusInternalServerError, string(err.Error()))
+		GenerateErrorResponse(w, r, err)
 	} else {
-		GenerateResponse(w, r, http.StatusOK, "Deletion of service is successful.")
+		GenerateResult(w, r, ResponseStringStruct{Response: "Deletion of service is successful."}, http.StatusNoContent, nil)
 	}
 }
@@ -27,15 +27,22 @@ import (
 
 func RouterRegister() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(asPrincipal(AdminPrincipal))
 	router.HandleFunc("/v1/register", HandleServiceCreate).Methods("POST")
+	router.HandleFunc("/v1/register", HandleServiceList).Methods("GET")
 	router.HandleFunc("/v1/register/{token}", HandleServiceGet).Methods("GET")
 	router.HandleFunc("/v1/register/{token}", HandleServiceDelete).Methods("DELETE")
+	router.HandleFunc("/v1/register/{token}/credentials", HandleServiceCredentialCreate).Methods("POST")
+	router.HandleFunc("/v1/register/{token}/credentials", HandleServiceCredentialList).Methods("GET")
+	router.HandleFunc("/v1/register/{token}/credentials/{name}", HandleServiceCredentialDelete).Methods("DELETE")
 	return router
 }
 
 func RouterRegisterSubdomain() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(asPrincipal(AdminPrincipal))
 	router.HandleFunc("/v1/register/{token}/subdomain", HandleServiceSubdomainCreate).Methods("POST")
+	router.HandleFunc("/v1/register/{token}/subdomain", HandleServiceSubdomainGet).Methods("GET")
 	router.HandleFunc("/v1/register/{token}/subdomain/{subdomain}", HandleServiceSubdomainDelete).Methods("DELETE")
 	return router
 }
@@ -159,7 +166,7 @@ func TestHandleServiceDelete_default(t *testing.T) {
 	response := httptest.NewRecorder()
 	RouterRegister().ServeHTTP(response, request)
 
-	assert.Equal(t, 406, response.Code, "406 response is expected")
+	assert.Equal(t, 403, response.Code, "403 response is expected")
 }
 
 func TestHandleServiceDelete_err(t *testing.T) {
@@ -230,6 +237,25 @@ func TestHandleServiceSuddomainCreate_no_subdomain(t *testing.T) {
 	assert.Equal(t, 400, response.Code, "400 response is expected")
 }
 
+func TestHandleServiceSuddomainCreate_traversal(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+
+	defer func() { Directory = oldDirectory }()
+
+	body := &CreateServiceSubdomainBody{
+		Subdomain: "../../etc",
+	}
+
+	b, _ := json.Marshal(body)
+
+	request, _ := http.NewRequest("POST", "/v1/register/token1/subdomain", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterRegisterSubdomain().ServeHTTP(response, request)
+
+	assert.Equal(t, 400, response.Code, "400 response is expected")
+}
+
 func TestHandleServiceSuddomainCreate_err(t *testing.T) {
 	oldDirectory := Directory
 	Directory = &FakeDirectoryErr{}
@@ -274,3 +300,161 @@ func TestHandleServiceSuddomainDelete_err(t *testing.T) {
 
 	assert.Equal(t, 500, response.Code, "500 response is expected")
 }
+
+func TestHandleServiceList(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("GET", "/v1/register", nil)
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+
+	var body ResponseServiceListStruct
+	json.NewDecoder(response.Body).Decode(&body)
+	assert.Equal(t, "token1", body.Response[0].Token)
+	assert.Equal(t, 1, body.Response[0].Subdomains)
+}
+
+func TestHandleServiceList_err(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectoryErr{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("GET", "/v1/register", nil)
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 500, response.Code, "500 response is expected")
+}
+
+func TestHandleServiceSubdomainGet(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("GET", "/v1/register/token1/subdomain", nil)
+	response := httptest.NewRecorder()
+	RouterRegisterSubdomain().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+
+	var body ResponseSubdomainListStruct
+	json.NewDecoder(response.Body).Decode(&body)
+	assert.Equal(t, []SubdomainInfo{
+		{Subdomain: "subdomain1", Files: []string{"config.properties"}},
+	}, body.Response)
+}
+
+func TestHandleServiceSubdomainGet_not_found(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("GET", "/v1/register/token2/subdomain", nil)
+	response := httptest.NewRecorder()
+	RouterRegisterSubdomain().ServeHTTP(response, request)
+
+	assert.Equal(t, 404, response.Code, "404 response is expected")
+}
+
+func TestHandleServiceSubdomainGet_err(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectoryErr{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("GET", "/v1/register/token1/subdomain", nil)
+	response := httptest.NewRecorder()
+	RouterRegisterSubdomain().ServeHTTP(response, request)
+
+	assert.Equal(t, 500, response.Code, "500 response is expected")
+}
+
+func TestHandleServiceCredentialCreate(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	b, _ := json.Marshal(&CreateServiceCredentialBody{Name: "ci", Role: ROLE_WRITER})
+
+	request, _ := http.NewRequest("POST", "/v1/register/token1/credentials", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+}
+
+func TestHandleServiceCredentialCreate_bad_role(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	for _, body := range []CreateServiceCredentialBody{{Name: "ci", Role: "root"}, {Role: ROLE_WRITER}} {
+		b, _ := json.Marshal(&body)
+
+		request, _ := http.NewRequest("POST", "/v1/register/token1/credentials", bytes.NewBuffer(b))
+		response := httptest.NewRecorder()
+		RouterRegister().ServeHTTP(response, request)
+
+		assert.Equal(t, 400, response.Code, "400 response is expected")
+	}
+}
+
+func TestHandleServiceCredentialCreate_err(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectoryErr{}
+	defer func() { Directory = oldDirectory }()
+
+	b, _ := json.Marshal(&CreateServiceCredentialBody{Name: "ci", Role: ROLE_WRITER})
+
+	request, _ := http.NewRequest("POST", "/v1/register/token1/credentials", bytes.NewBuffer(b))
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 500, response.Code, "500 response is expected")
+}
+
+func TestHandleServiceCredentialList(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("GET", "/v1/register/token1/credentials", nil)
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+	assert.NotContains(t, response.Body.String(), "secret")
+
+	request, _ = http.NewRequest("GET", "/v1/register/token2/credentials", nil)
+	response = httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 404, response.Code, "404 response is expected")
+}
+
+func TestHandleServiceCredentialDelete(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectory{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("DELETE", "/v1/register/token1/credentials/ci", nil)
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 200, response.Code, "200 response is expected")
+}
+
+func TestHandleServiceCredentialDelete_err(t *testing.T) {
+	oldDirectory := Directory
+	Directory = &FakeDirectoryErr{}
+	defer func() { Directory = oldDirectory }()
+
+	request, _ := http.NewRequest("DELETE", "/v1/register/token1/credentials/ci", nil)
+	response := httptest.NewRecorder()
+	RouterRegister().ServeHTTP(response, request)
+
+	assert.Equal(t, 500, response.Code, "500 response is expected")
+}
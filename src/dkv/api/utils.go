@@ -21,19 +21,56 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 var (
 	IoutilRead  = ioutil.ReadFile
-	IoutilWrite = ioutil.WriteFile
+	IoutilWrite = WriteFileAtomic
 	JsonReader  = ReadJSON
 	JsonChecker = CheckJSONExists
 	JsonCreate  = CreateJSON
+	JsonRepair  = RepairJSON
 )
 
+// Serializes the read-modify-write cycles on token_service_map.json.
+var jsonMutex sync.Mutex
+
 type Token_service_map struct {
-	Token   string `json:"token"`
-	Service string `json:"service"`
+	Token       string       `json:"token"`
+	Service     string       `json:"service"`
+	CreatedAt   string       `json:"created_at,omitempty"`
+	Credentials []Credential `json:"credentials,omitempty"`
+}
+
+// Credential is a named secret of a service carrying one of the ROLE_* roles.
+type Credential struct {
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	SecretHash string `json:"secret_hash"`
+}
+
+// Replaces the credential with the same name, or adds it.
+func setCredential(credentials []Credential, credential Credential) []Credential {
+	for i := range credentials {
+		if credentials[i].Name == credential.Name {
+			credentials[i] = credential
+			return credentials
+		}
+	}
+	return append(credentials, credential)
+}
+
+func removeCredential(credentials []Credential, name string) ([]Credential, bool) {
+	for i := range credentials {
+		if credentials[i].Name == name {
+			return append(credentials[:i], credentials[i+1:]...), true
+		}
+	}
+	return credentials, false
 }
 
 func CheckJSONExists(path string) (bool, error) {
@@ -46,12 +83,62 @@ func CheckJSONExists(path string) (bool, error) {
 	}
 }
 
+/*
+WriteFileAtomic writes data to a temporary file in the same directory, syncs
+it and renames it over path. Readers see either the old or the new contents,
+never a partially written file, even if the process crashes mid-write.
+*/
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// No-op once the rename has succeeded.
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	// Make the rename itself durable.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	d.Sync()
+
+	return nil
+}
+
 func CreateJSON(path string) error {
+	jsonMutex.Lock()
+	defer jsonMutex.Unlock()
+
 	var tsm Token_service_map
 	var tsm_list []Token_service_map
 
 	tsm.Token = "default"
 	tsm.Service = "default"
+	tsm.CreatedAt = time.Now().UTC().Format(time.RFC3339)
 	tsm_list = append(tsm_list, tsm)
 	raw, err := json.Marshal(tsm_list)
 	if err != nil {
@@ -71,11 +158,46 @@ func ReadJSON(path string) ([]Token_service_map, error) {
 	if err != nil {
 		return tsm_list, err
 	}
-	json.Unmarshal(raw, &tsm_list)
+	err = json.Unmarshal(raw, &tsm_list)
+	if err != nil {
+		return tsm_list, errors.New("Registry file " + filepath.Base(path) + " is corrupt: " + err.Error())
+	}
 	return tsm_list, nil
 }
 
+/*
+CheckJSONCorrupt reports whether the file at path exists but cannot be parsed
+as a list of Token_service_map records.
+*/
+func CheckJSONCorrupt(path string) (bool, error) {
+	raw, err := IoutilRead(path)
+	if err != nil {
+		return false, err
+	}
+	var tsm_list []Token_service_map
+	err = json.Unmarshal(raw, &tsm_list)
+	if err != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+/*
+RepairJSON moves a corrupt registry file aside to path.corrupt, keeping it for
+manual recovery, and creates a fresh registry holding only the default service.
+*/
+func RepairJSON(path string) error {
+	err := os.Rename(path, path+".corrupt")
+	if err != nil {
+		return err
+	}
+	return JsonCreate(path)
+}
+
 func WriteJSON(path string, token string, service string) error {
+	jsonMutex.Lock()
+	defer jsonMutex.Unlock()
+
 	tsm_list, err := JsonReader(path)
 	if err != nil {
 		return err
@@ -83,6 +205,7 @@ func WriteJSON(path string, token string, service string) error {
 	var tsm Token_service_map
 	tsm.Token = token
 	tsm.Service = service
+	tsm.CreatedAt = time.Now().UTC().Format(time.RFC3339)
 	tsm_list = append(tsm_list, tsm)
 	raw, err := json.Marshal(tsm_list)
 	if err != nil {
@@ -96,6 +219,9 @@ func WriteJSON(path string, token string, service string) error {
 }
 
 func DeleteInJSON(path string, token string) error {
+	jsonMutex.Lock()
+	defer jsonMutex.Unlock()
+
 	serviceList, err := JsonReader(path)
 	if err != nil {
 		return err
@@ -115,7 +241,7 @@ func DeleteInJSON(path string, token string) error {
 	}
 
 	if foundFlag == false {
-		return errors.New("Service not found. Check if Token is correct or service is registered.")
+		return NotFoundError("Service not found. Check if Token is correct or service is registered.")
 	} else {
 		// This is done to avoid writing 'null' in the json file.
 		if len(serviceList) == 1 {
@@ -163,16 +289,88 @@ func FindServiceInJSON(path string, serviceName string) (bool, error) {
 }
 
 func GetServicebyToken(path string, token string) (string, bool, error) {
+	service, found, err := GetServiceRecordByToken(path, token)
+	return service.Service, found, err
+}
+
+func GetServiceRecordByToken(path string, token string) (Token_service_map, bool, error) {
+	serviceList, err := JsonReader(path)
+	if err != nil {
+		return Token_service_map{}, false, err
+	}
+	for _, service := range serviceList {
+		if service.Token == token {
+			return service, true, nil
+		}
+	}
+	return Token_service_map{}, false, nil
+}
+
+/*
+updateCredentialsInJSON applies update to the credentials of the service
+identified by token and writes the registry back.
+*/
+func updateCredentialsInJSON(path string, token string, update func([]Credential) ([]Credential, error)) error {
+	jsonMutex.Lock()
+	defer jsonMutex.Unlock()
+
+	serviceList, err := JsonReader(path)
+	if err != nil {
+		return err
+	}
+
+	var foundFlag = false
+	for i := range serviceList {
+		if serviceList[i].Token == token {
+			serviceList[i].Credentials, err = update(serviceList[i].Credentials)
+			if err != nil {
+				return err
+			}
+			foundFlag = true
+		}
+	}
+	if foundFlag == false {
+		return NotFoundError("Service not found. Check if Token is correct or service is registered.")
+	}
+
+	raw, err := json.Marshal(serviceList)
+	if err != nil {
+		return err
+	}
+	err = IoutilWrite(path, raw, 0644)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func SetCredentialInJSON(path string, token string, credential Credential) error {
+	return updateCredentialsInJSON(path, token, func(credentials []Credential) ([]Credential, error) {
+		return setCredential(credentials, credential), nil
+	})
+}
+
+func DeleteCredentialInJSON(path string, token string, name string) error {
+	return updateCredentialsInJSON(path, token, func(credentials []Credential) ([]Credential, error) {
+		credentials, found := removeCredential(credentials, name)
+		if found == false {
+			return credentials, NotFoundError("Credential " + name + " not found.")
+		}
+		return credentials, nil
+	})
+}
+
+func GetCredentialsInJSON(path string, token string) ([]Credential, bool, error) {
 	serviceList, err := JsonReader(path)
 	if err != nil {
-		return "", false, err
+		return nil, false, err
 	}
 	for _, service := range serviceList {
 		if service.Token == token {
-			return service.Service, true, nil
+			return service.Credentials, true, nil
 		}
 	}
-	return "", false, nil
+	return nil, false, nil
 }
 
 func GenerateResponse(w http.ResponseWriter, r *http.Request, httpStatus int, msg string) {
@@ -17,7 +17,11 @@ package api
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -70,12 +74,29 @@ func TestReadJSON(t *testing.T) {
 	}()
 
 	IoutilRead = func(path string) ([]byte, error) {
-		return []byte("test"), nil
+		return []byte(`[{"token":"token1","service":"service1"}]`), nil
 	}
 
-	_, err := ReadJSON("path")
+	tsm_list, err := ReadJSON("path")
 	assert.Equal(t, nil, err, "Error should be nil.")
+	assert.Equal(t, []Token_service_map{{Token: "token1", Service: "service1"}}, tsm_list)
+}
+
+func TestReadJSON_corrupt(t *testing.T) {
+	oldIoutilRead := IoutilRead
+
+	defer func() {
+		IoutilRead = oldIoutilRead
+	}()
+
+	IoutilRead = func(path string) ([]byte, error) {
+		return []byte(`[{"token":"token1","serv`), nil
+	}
+
+	_, err := ReadJSON("path")
+	assert.NotNil(t, err, "Err should not be nil.")
 }
+
 func TestReadJSON_err(t *testing.T) {
 	oldIoutilRead := IoutilRead
 
@@ -344,3 +365,152 @@ func TestGetServicebyToken_not_found(t *testing.T) {
 	assert.Equal(t, "", service, "Service is found")
 	assert.False(t, found, "Token should be found in JSON.")
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "dkv-utils")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token_service_map.json")
+
+	err := WriteFileAtomic(path, []byte("value1"), 0644)
+	assert.Nil(t, err)
+	err = WriteFileAtomic(path, []byte("value2"), 0644)
+	assert.Nil(t, err)
+
+	raw, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "value2", string(raw))
+
+	// No temporary files are left behind.
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestWriteJSON_concurrent(t *testing.T) {
+	oldIoutilRead := IoutilRead
+	oldIoutilWrite := IoutilWrite
+	oldReadJson := JsonReader
+
+	defer func() {
+		IoutilRead = oldIoutilRead
+		IoutilWrite = oldIoutilWrite
+		JsonReader = oldReadJson
+	}()
+
+	IoutilRead = ioutil.ReadFile
+	IoutilWrite = WriteFileAtomic
+	JsonReader = ReadJSON
+
+	dir, _ := ioutil.TempDir("", "dkv-utils")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token_service_map.json")
+	CreateJSON(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			WriteJSON(path, "token"+strconv.Itoa(i), "service"+strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+
+	// No registration is lost.
+	tsm_list, err := ReadJSON(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 21, len(tsm_list))
+}
+
+func TestCheckJSONCorrupt(t *testing.T) {
+	oldIoutilRead := IoutilRead
+
+	defer func() {
+		IoutilRead = oldIoutilRead
+	}()
+
+	IoutilRead = func(path string) ([]byte, error) {
+		return []byte(`[{"token":"default","service":"default"}]`), nil
+	}
+	corrupt, err := CheckJSONCorrupt("path")
+	assert.Nil(t, err)
+	assert.False(t, corrupt)
+
+	IoutilRead = func(path string) ([]byte, error) {
+		return []byte(""), nil
+	}
+	corrupt, err = CheckJSONCorrupt("path")
+	assert.Nil(t, err)
+	assert.True(t, corrupt)
+}
+
+func TestRepairJSON(t *testing.T) {
+	oldIoutilRead := IoutilRead
+	oldIoutilWrite := IoutilWrite
+
+	defer func() {
+		IoutilRead = oldIoutilRead
+		IoutilWrite = oldIoutilWrite
+	}()
+
+	IoutilRead = ioutil.ReadFile
+	IoutilWrite = WriteFileAtomic
+
+	dir, _ := ioutil.TempDir("", "dkv-utils")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token_service_map.json")
+	ioutil.WriteFile(path, []byte(`[{"token":"tok`), 0644)
+
+	r := &JSONRegistryStruct{path: path}
+	err := r.InitialiseRegistry()
+	assert.Nil(t, err)
+
+	tsm_list, err := ReadJSON(path)
+	assert.Nil(t, err)
+	assert.Len(t, tsm_list, 1)
+	assert.Equal(t, "default", tsm_list[0].Token)
+	assert.Equal(t, "default", tsm_list[0].Service)
+
+	raw, _ := ioutil.ReadFile(path + ".corrupt")
+	assert.Equal(t, `[{"token":"tok`, string(raw), "Corrupt file should be kept aside.")
+}
+
+func TestCredentialsInJSON(t *testing.T) {
+	oldIoutilRead := IoutilRead
+	oldIoutilWrite := IoutilWrite
+	oldReadJson := JsonReader
+	defer func() {
+		IoutilRead = oldIoutilRead
+		IoutilWrite = oldIoutilWrite
+		JsonReader = oldReadJson
+	}()
+	IoutilRead = ioutil.ReadFile
+	IoutilWrite = WriteFileAtomic
+	JsonReader = ReadJSON
+
+	dir, _ := ioutil.TempDir("", "dkv-utils")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token_service_map.json")
+	CreateJSON(path)
+	WriteJSON(path, "token1", "service1")
+
+	err := SetCredentialInJSON(path, "token1", Credential{Name: "ci", Role: ROLE_WRITER, SecretHash: "hash1"})
+	assert.Nil(t, err)
+
+	credentials, found, err := GetCredentialsInJSON(path, "token1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []Credential{{Name: "ci", Role: ROLE_WRITER, SecretHash: "hash1"}}, credentials)
+
+	credentials, found, _ = GetCredentialsInJSON(path, "default")
+	assert.True(t, found)
+	assert.Empty(t, credentials)
+
+	err = DeleteCredentialInJSON(path, "token1", "ci")
+	assert.Nil(t, err)
+	err = DeleteCredentialInJSON(path, "token1", "ci")
+	assert.NotNil(t, err)
+	credentials, _, _ = GetCredentialsInJSON(path, "token1")
+	assert.Empty(t, credentials)
+
+	err = SetCredentialInJSON(path, "token2", Credential{Name: "ci", Role: ROLE_WRITER, SecretHash: "hash1"})
+	assert.NotNil(t, err)
+}
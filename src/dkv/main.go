@@ -31,33 +31,64 @@ func main() {
 		log.Fatal(err)
 	}
 	router := mux.NewRouter()
+	registerRoutes(router.PathPrefix("/v1").Subrouter())
+	// /v2 has the same routes, answering with structured objects and error envelopes.
+	v2 := router.PathPrefix("/v2").Subrouter()
+	v2.Use(api.V2Responses)
+	registerRoutes(v2)
+
+	loggedRouter := handlers.LoggingHandler(os.Stdout, router)
+	log.Println("[INFO] Started Distributed KV Store server.")
+	log.Fatal(http.ListenAndServe(":8080", loggedRouter))
+}
+
+func registerRoutes(router *mux.Router) {
+	// Every route needs "Authorization: Bearer <secret>". Routes acting on a
+	// service take the secret of one of its credentials, global routes take
+	// ADMIN_SECRET. The admin secret is accepted everywhere. The handlers check
+	// the role of the credential.
+	service := func(h http.HandlerFunc) http.HandlerFunc {
+		return api.RequireServiceAuth(api.TokenFromPath, h)
+	}
 	// Sevice Registration
 	// Domain CRUD
-	router.HandleFunc("/v1/register", api.HandleServiceCreate).Methods("POST")
-	router.HandleFunc("/v1/register/{token}", api.HandleServiceGet).Methods("GET")
-	router.HandleFunc("/v1/register/{token}", api.HandleServiceDelete).Methods("DELETE")
+	router.HandleFunc("/register", api.HandleServiceCreate).Methods("POST")
+	router.HandleFunc("/register", api.RequireAdminAuth(api.HandleServiceList)).Methods("GET")
+	router.HandleFunc("/register/{token}", service(api.HandleServiceGet)).Methods("GET")
+	router.HandleFunc("/register/{token}", service(api.HandleServiceDelete)).Methods("DELETE")
+	// Credential CRUD
+	router.HandleFunc("/register/{token}/credentials", service(api.HandleServiceCredentialCreate)).Methods("POST")
+	router.HandleFunc("/register/{token}/credentials", service(api.HandleServiceCredentialList)).Methods("GET")
+	router.HandleFunc("/register/{token}/credentials/{name}", service(api.HandleServiceCredentialDelete)).Methods("DELETE")
 	// Subdomain CRUD
-	router.HandleFunc("/v1/register/{token}/subdomain", api.HandleServiceSubdomainCreate).Methods("POST")
-	// router.HandleFunc("/v1/register/{token}/subdomain", api.HandleServiceSubdomainGet).Methods("GET")
-	router.HandleFunc("/v1/register/{token}/subdomain/{subdomain}", api.HandleServiceSubdomainDelete).Methods("DELETE")
+	router.HandleFunc("/register/{token}/subdomain", service(api.HandleServiceSubdomainCreate)).Methods("POST")
+	router.HandleFunc("/register/{token}/subdomain", service(api.HandleServiceSubdomainGet)).Methods("GET")
+	router.HandleFunc("/register/{token}/subdomain/{subdomain}", service(api.HandleServiceSubdomainDelete)).Methods("DELETE")
 	// Configuration CRUD
-	router.HandleFunc("/v1/config", api.HandleConfigUpload).Methods("POST")
-	router.HandleFunc("/v1/config/{token}/{filename}", api.HandleConfigGet).Methods("GET")
-	router.HandleFunc("/v1/config/{token}/{subdomain}/{filename}", api.HandleConfigGet).Methods("GET")
-	router.HandleFunc("/v1/config/{token}/{filename}", api.HandleConfigDelete).Methods("DELETE")
-	router.HandleFunc("/v1/config/{token}/{subdomain}/{filename}", api.HandleConfigDelete).Methods("DELETE")
-	router.HandleFunc("/v1/config/load", api.HandleConfigLoad).Methods("POST")
+	router.HandleFunc("/config", api.RequireServiceAuth(api.TokenFromForm, api.HandleConfigUpload)).Methods("POST")
+	router.HandleFunc("/config/{token}/{filename}", service(api.HandleConfigGet)).Methods("GET")
+	router.HandleFunc("/config/{token}/{subdomain}/{filename}", service(api.HandleConfigGet)).Methods("GET")
+	router.HandleFunc("/config/{token}/{filename}", service(api.HandleConfigDelete)).Methods("DELETE")
+	router.HandleFunc("/config/{token}/{subdomain}/{filename}", service(api.HandleConfigDelete)).Methods("DELETE")
+	router.HandleFunc("/config/{token}/keys/{key}", service(api.HandleKeyPUT)).Methods("PUT")
+	router.HandleFunc("/config/{token}/{subdomain}/keys/{key}", service(api.HandleKeyPUT)).Methods("PUT")
+	router.HandleFunc("/config/{token}/keys", service(api.HandleKeysPATCH)).Methods("PATCH")
+	router.HandleFunc("/config/{token}/{subdomain}/keys", service(api.HandleKeysPATCH)).Methods("PATCH")
+	router.HandleFunc("/config/load", api.RequireServiceAuth(api.TokenFromBody, api.HandleConfigLoad)).Methods("POST")
 	// Load default configs
-	router.HandleFunc("/v1/config/load-default", api.HandleDefaultConfigLoad).Methods("GET")
+	router.HandleFunc("/config/load-default", api.RequireAdminAuth(api.HandleDefaultConfigLoad)).Methods("GET")
 
 	// Direct Datastore queries.
-	router.HandleFunc("/v1/getconfig/{token}/{key}", api.HandleGET).Methods("GET")
-	// TODO(sshank): Following methods should not be allowed for all users. Remove it or make sure
-	// its accessible only by admin.
-	router.HandleFunc("/v1/deleteconfig/{key}", api.HandleDELETE).Methods("DELETE")
-	router.HandleFunc("/v1/getconfigs", api.HandleGETS).Methods("GET")
-
-	loggedRouter := handlers.LoggingHandler(os.Stdout, router)
-	log.Println("[INFO] Started Distributed KV Store server.")
-	log.Fatal(http.ListenAndServe(":8080", loggedRouter))
+	// Keys fall back from the subdomain to the service and then to default.
+	router.HandleFunc("/getconfig/{token}/{key}", service(api.HandleGET)).Methods("GET")
+	router.HandleFunc("/getconfig/{token}/{subdomain}/{key}", service(api.HandleGET)).Methods("GET")
+	router.HandleFunc("/effectiveconfig/{token}", service(api.HandleEffectiveConfigGet)).Methods("GET")
+	router.HandleFunc("/effectiveconfig/{token}/{subdomain}", service(api.HandleEffectiveConfigGet)).Methods("GET")
+	router.HandleFunc("/getconfigs/{token}", service(api.HandleServiceGETS)).Methods("GET")
+	router.HandleFunc("/getconfigs/{token}/{subdomain}", service(api.HandleServiceGETS)).Methods("GET")
+	// Keys are addressed under the layer they were loaded to.
+	router.HandleFunc("/deleteconfig/{token}/{key}", service(api.HandleDELETE)).Methods("DELETE")
+	router.HandleFunc("/deleteconfig/{token}/{subdomain}/{key}", service(api.HandleDELETE)).Methods("DELETE")
+	// Not scoped to a service, so admin only.
+	router.HandleFunc("/getconfigs", api.RequireAdminAuth(api.HandleGETS)).Methods("GET")
 }